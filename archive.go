@@ -0,0 +1,299 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ConfigArchive contains the parsed contents of a maltego configuration archive (.mtz).
+type ConfigArchive struct {
+	Entities   []*MaltegoEntity
+	Transforms []*MaltegoTransform
+
+	// TransformSettings are mapped to the name of the transform they belong to.
+	TransformSettings map[string]*TransformSettings
+
+	Servers       []*Server
+	TransformSets []*TransformSet
+}
+
+// LoadConfigArchive reads the maltego configuration archive at file and parses its contents.
+func LoadConfigArchive(file string) (*ConfigArchive, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	archive := &ConfigArchive{
+		TransformSettings: make(map[string]*TransformSettings),
+	}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		var v interface{}
+
+		switch ext := path.Ext(f.Name); ext {
+		case ".entity":
+			e := &MaltegoEntity{}
+			archive.Entities = append(archive.Entities, e)
+			v = e
+		case ".transform":
+			t := &MaltegoTransform{}
+			archive.Transforms = append(archive.Transforms, t)
+			v = t
+		case ".transformsettings":
+			s := &TransformSettings{}
+			archive.TransformSettings[strings.TrimSuffix(path.Base(f.Name), ext)] = s
+			v = s
+		case ".tas":
+			s := &Server{}
+			archive.Servers = append(archive.Servers, s)
+			v = s
+		case ".set":
+			s := &TransformSet{}
+			archive.TransformSets = append(archive.TransformSets, s)
+			v = s
+		default:
+			continue
+		}
+
+		err = unmarshalZipFile(f, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+// unmarshalZipFile reads the XML contents of the zip file f into v.
+func unmarshalZipFile(f *zip.File, v interface{}) error {
+	data, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+
+	err = xml.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", f.Name, err)
+	}
+
+	return nil
+}
+
+// MergeArchives merges the contents of the maltego configuration archives at inputs into a new archive at out.
+// Server listings, including their seeds, and transform sets with the same name are combined,
+// transforms and seeds they have in common are only listed once. The version.properties of the first input is used.
+// Entities and transforms that are contained in more than one input, as well as other files with the same name
+// but different contents, are reported as collisions and no archive is written.
+func MergeArchives(out string, inputs ...string) error {
+	var (
+		files      = make(map[string][]byte)
+		servers    = make(map[string]*Server)
+		sets       = make(map[string]*TransformSet)
+		collisions []string
+	)
+
+	for _, in := range inputs {
+		r, err := zip.OpenReader(in)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range r.File {
+			data, errRead := readZipFile(f)
+			if errRead != nil {
+				_ = r.Close()
+				return errRead
+			}
+
+			switch {
+			case f.FileInfo().IsDir():
+				files[f.Name] = nil
+			case path.Ext(f.Name) == ".tas":
+				s := &Server{}
+				if err = xml.Unmarshal(data, s); err != nil {
+					_ = r.Close()
+					return fmt.Errorf("failed to unmarshal %s in %s: %w", f.Name, in, err)
+				}
+				if existing, ok := servers[f.Name]; ok {
+					existing.Transforms.Transform = mergeTransforms(existing.Transforms.Transform, s.Transforms.Transform)
+					existing.Seeds.Items = mergeSeeds(existing.Seeds.Items, s.Seeds.Items)
+				} else {
+					servers[f.Name] = s
+				}
+			case path.Ext(f.Name) == ".set":
+				s := &TransformSet{}
+				if err = xml.Unmarshal(data, s); err != nil {
+					_ = r.Close()
+					return fmt.Errorf("failed to unmarshal %s in %s: %w", f.Name, in, err)
+				}
+				if existing, ok := sets[f.Name]; ok {
+					existing.Transforms.Transform = mergeTransforms(existing.Transforms.Transform, s.Transforms.Transform)
+				} else {
+					sets[f.Name] = s
+				}
+			case f.Name == "version.properties":
+				if _, ok := files[f.Name]; !ok {
+					files[f.Name] = data
+				}
+			default:
+				existing, ok := files[f.Name]
+				if !ok {
+					files[f.Name] = data
+					continue
+				}
+				if strings.HasPrefix(f.Name, "Entities/") || strings.HasPrefix(f.Name, "TransformRepositories/") || !bytes.Equal(existing, data) {
+					collisions = append(collisions, f.Name+" ("+in+")")
+				}
+			}
+		}
+
+		err = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("%w: %s", ErrArchiveCollision, strings.Join(collisions, ", "))
+	}
+
+	for name, s := range servers {
+		data, err := xml.MarshalIndent(s, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal server listing %s: %w", name, err)
+		}
+		files[name] = data
+	}
+
+	for name, s := range sets {
+		data, err := xml.MarshalIndent(s, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal transform set %s: %w", name, err)
+		}
+		files[name] = data
+	}
+
+	return writeArchive(out, files)
+}
+
+// transformRef references a transform by name in a server listing or transform set.
+type transformRef = struct {
+	Text string `xml:",chardata"`
+	Name string `xml:"name,attr"`
+}
+
+// mergeTransforms appends the transforms from src that are not yet referenced in dst.
+func mergeTransforms(dst, src []transformRef) []transformRef {
+	seen := make(map[string]struct{}, len(dst))
+	for _, t := range dst {
+		seen[t.Name] = struct{}{}
+	}
+
+	for _, t := range src {
+		if _, ok := seen[t.Name]; !ok {
+			seen[t.Name] = struct{}{}
+			dst = append(dst, t)
+		}
+	}
+
+	return dst
+}
+
+// mergeSeeds appends the seeds from src whose name is not yet contained in dst.
+func mergeSeeds(dst, src []Seed) []Seed {
+	seen := make(map[string]struct{}, len(dst))
+	for _, s := range dst {
+		seen[s.Name] = struct{}{}
+	}
+
+	for _, s := range src {
+		if _, ok := seen[s.Name]; !ok {
+			seen[s.Name] = struct{}{}
+			dst = append(dst, s)
+		}
+	}
+
+	return dst
+}
+
+// ErrArchiveCollision indicates that archives can not be merged, because they contain conflicting files.
+var ErrArchiveCollision = errors.New("archive collision")
+
+// writeArchive writes the files into a new archive at out, sorted by name.
+// Names with a trailing slash and no data are added as directory entries.
+func writeArchive(out string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	modTime, err := ArchiveOptions{}.timestamp()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errClose := f.Close(); errClose != nil {
+			fmt.Println(errClose)
+		}
+	}()
+
+	w := zip.NewWriter(f)
+
+	for _, name := range names {
+		fw, errCreate := createEntry(w, name, modTime)
+		if errCreate != nil {
+			return errCreate
+		}
+
+		_, err = fw.Write(files[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// readZipFile returns the contents of the zip file f.
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,221 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// genTestArchive generates and packs a configuration archive named ident in the current directory,
+// containing an entity and a transform for each of the provided names.
+func genTestArchive(t *testing.T, ident string, names ...string) {
+	if err := GenMaltegoArchiveE(ident, "Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var trs []*TransformCoreInfo
+	for _, name := range names {
+		if err := GenEntityE("", "Test", ident, "test.", "properties.", ident, name, "", "A "+name+" entity", "", "", nil, NewStringField("field", "A field")); err != nil {
+			t.Fatal(err)
+		}
+		if err := GenTransformE("/", "Org", "Author", "test.", ident, "To"+name, "A test transform", "test."+name, "test", []string{"to" + name}, false); err != nil {
+			t.Fatal(err)
+		}
+		trs = append(trs, &TransformCoreInfo{ID: "To" + name})
+	}
+
+	if err := GenServerListingE("test.", ident, trs); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenTransformSetE("Test", "Test transforms", "test.", ident, trs); err != nil {
+		t.Fatal(err)
+	}
+	if err := PackMaltegoArchiveE(ident); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chdirTemp changes into a new temporary directory for the duration of the test.
+func chdirTemp(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransformSettingsRoundTrip(t *testing.T) {
+	trs := NewTransformSettings("/", []string{"toPCAP"}, false, "pcap")
+
+	data, err := xml.Marshal(trs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the properties used to be dropped when parsing, because the items were expected in nested Properties elements
+	var parsed TransformSettings
+	if err = xml.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed.Property.Items) != len(trs.Property.Items) {
+		t.Fatal("unexpected transform setting properties", parsed.Property.Items)
+	}
+	for i, p := range parsed.Property.Items {
+		if p.Name != trs.Property.Items[i].Name || p.Text != trs.Property.Items[i].Text {
+			t.Fatal("unexpected transform setting property", p)
+		}
+	}
+}
+
+func TestLoadConfigArchive(t *testing.T) {
+	chdirTemp(t)
+	genTestArchive(t, "test", "Interface", "PCAP")
+
+	archive, err := LoadConfigArchive("test" + configFileExtension)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archive.Entities) != 2 {
+		t.Fatal("expected 2 entities, got", len(archive.Entities))
+	}
+
+	for i, name := range []string{"Interface", "PCAP"} {
+		expected := NewMaltegoEntity("Test", "test", "test.", "properties.", name, "", "A "+name+" entity", "", nil, NewStringField("field", "A field"))
+
+		e := archive.Entities[i]
+		if e.ID != expected.ID || e.Description != expected.Description || e.Category != expected.Category {
+			t.Fatal("unexpected entity", e.ID, e.Description, e.Category)
+		}
+		if len(e.Properties.Fields.Items) != 2 || e.Properties.Fields.Items[1].Name != "field" {
+			t.Fatal("unexpected entity fields", e.Properties.Fields.Items)
+		}
+	}
+
+	if len(archive.Transforms) != 2 || archive.Transforms[0].Name != "test.ToInterface" {
+		t.Fatal("unexpected transforms", archive.Transforms)
+	}
+
+	trs, ok := archive.TransformSettings["test.ToPCAP"]
+	if !ok || trs.Property.Items[1].Text != "toPCAP" {
+		t.Fatal("unexpected transform settings", archive.TransformSettings)
+	}
+
+	if len(archive.Servers) != 1 || len(archive.Servers[0].Transforms.Transform) != 2 {
+		t.Fatal("unexpected servers", archive.Servers)
+	}
+
+	if len(archive.TransformSets) != 1 || archive.TransformSets[0].Name != "Test" {
+		t.Fatal("unexpected transform sets", archive.TransformSets)
+	}
+}
+
+func TestMergeArchives(t *testing.T) {
+	chdirTemp(t)
+	genTestArchive(t, "a", "Interface")
+	genTestArchive(t, "b", "PCAP")
+	genTestArchive(t, "c", "Interface")
+
+	err := MergeArchives("merged"+configFileExtension, "a"+configFileExtension, "b"+configFileExtension)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := LoadConfigArchive("merged" + configFileExtension)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archive.Entities) != 2 || len(archive.Transforms) != 2 || len(archive.TransformSettings) != 2 {
+		t.Fatal("unexpected merged archive contents", len(archive.Entities), len(archive.Transforms), len(archive.TransformSettings))
+	}
+
+	if len(archive.Servers) != 1 || len(archive.Servers[0].Transforms.Transform) != 2 {
+		t.Fatal("unexpected merged servers", archive.Servers)
+	}
+
+	if len(archive.TransformSets) != 1 || len(archive.TransformSets[0].Transforms.Transform) != 2 {
+		t.Fatal("unexpected merged transform sets", archive.TransformSets)
+	}
+
+	err = MergeArchives("collision"+configFileExtension, "a"+configFileExtension, "c"+configFileExtension)
+	if !errors.Is(err, ErrArchiveCollision) {
+		t.Fatal("expected collision error, got", err)
+	}
+	if !strings.Contains(err.Error(), "Entities/test.Interface.entity") {
+		t.Fatal("collision error does not name the entity:", err)
+	}
+}
+
+func TestMergeArchivesOverlappingSets(t *testing.T) {
+	chdirTemp(t)
+	genTestArchive(t, "a", "Interface")
+
+	// b lists the transform of a in its set and server listing, but only ships its own transform
+	if err := GenMaltegoArchiveE("b", "Test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenTransformE("/", "Org", "Author", "test.", "b", "ToPCAP", "A test transform", "test.PCAP", "test", []string{"toPCAP"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	trs := []*TransformCoreInfo{{ID: "ToInterface"}, {ID: "ToPCAP"}}
+
+	// both server listings contain the same seed
+	cfg := DefaultServerConfig()
+	cfg.Seeds = []Seed{{Name: "Local", URL: "http://localhost/seed"}}
+	if err := GenServerListingWithConfig(cfg, "test.", "a", trs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenServerListingWithConfig(cfg, "test.", "b", trs); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenTransformSetE("Test", "Test transforms", "test.", "b", trs); err != nil {
+		t.Fatal(err)
+	}
+	for _, ident := range []string{"a", "b"} {
+		if err := PackMaltegoArchiveE(ident); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := MergeArchives("merged"+configFileExtension, "a"+configFileExtension, "b"+configFileExtension)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := LoadConfigArchive("merged" + configFileExtension)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archive.Servers) != 1 || len(archive.Servers[0].Transforms.Transform) != 2 || len(archive.Servers[0].Seeds.Items) != 1 {
+		t.Fatal("unexpected merged servers", archive.Servers)
+	}
+
+	if len(archive.TransformSets) != 1 || len(archive.TransformSets[0].Transforms.Transform) != 2 {
+		t.Fatal("unexpected merged transform sets", archive.TransformSets)
+	}
+}
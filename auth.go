@@ -0,0 +1,68 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the name of the header that is checked for the API key by WithAuth.
+var APIKeyHeader = "X-API-Key"
+
+// WithAuth wraps the handler and only invokes it for requests with a valid API key.
+// The key is read from the APIKeyHeader, or from the Authorization header, either as bare token or with the Bearer scheme.
+// Requests without a valid key are answered with an exception. It is sent with status 200,
+// since maltego only displays the exception messages of successful responses.
+func WithAuth(next http.HandlerFunc, validate func(apiKey string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		key := apiKey(r)
+		if key == "" || !validate(key) {
+			logger.Log("unauthorized request", "remote", r.RemoteAddr, "transform", transformName(r), "keyProvided", key != "")
+
+			recordException(r)
+			if key == "" {
+				w.Write([]byte(exceptionOutput("missing API key")))
+			} else {
+				w.Write([]byte(exceptionOutput("invalid API key")))
+			}
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// apiKey returns the API key provided with the request, or an empty string if there is none.
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+
+	// other schemes, such as Basic, do not carry an API key
+	if i := strings.IndexByte(auth, ' '); i >= 0 {
+		if strings.EqualFold(auth[:i], "Bearer") {
+			return strings.TrimSpace(auth[i+1:])
+		}
+		return ""
+	}
+	if strings.EqualFold(auth, "Bearer") {
+		return ""
+	}
+
+	return auth
+}
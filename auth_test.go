@@ -0,0 +1,60 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithAuth(t *testing.T) {
+	h := WithAuth(MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	}), func(apiKey string) bool {
+		return apiKey == "secret"
+	})
+
+	for _, c := range []struct {
+		header, value string
+		status        int
+		body          string
+	}{
+		{APIKeyHeader, "secret", http.StatusOK, "<Value>93.184.216.34</Value>"},
+		{"Authorization", "Bearer secret", http.StatusOK, "<Value>93.184.216.34</Value>"},
+		{"Authorization", "secret", http.StatusOK, "<Value>93.184.216.34</Value>"},
+		{"", "", http.StatusOK, `<Exception code="">missing API key</Exception>`},
+		{APIKeyHeader, "guess", http.StatusOK, `<Exception code="">invalid API key</Exception>`},
+		{"Authorization", "Bearer guess", http.StatusOK, `<Exception code="">invalid API key</Exception>`},
+		{"Authorization", "Basic c2VjcmV0", http.StatusOK, `<Exception code="">missing API key</Exception>`},
+		{"Authorization", "Bearer", http.StatusOK, `<Exception code="">missing API key</Exception>`},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest))
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		h(rec, req)
+
+		if rec.Code != c.status {
+			t.Fatal("unexpected status for", c.header, c.value, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), c.body) {
+			t.Fatal("unexpected response for", c.header, c.value, rec.Body.String())
+		}
+	}
+}
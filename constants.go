@@ -39,6 +39,76 @@ const (
 	Loose = "loose"
 )
 
+// BookmarkColor is the color of an entity bookmark.
+type BookmarkColor string
+
+// bookmark colors
+const (
+	BookmarkColorNone   BookmarkColor = BookMarkColorNone
+	BookmarkColorBlue   BookmarkColor = BookMarkColorBlue
+	BookmarkColorGreen  BookmarkColor = BookMarkColorGreen
+	BookmarkColorYellow BookmarkColor = BookMarkColorYellow
+	BookmarkColorOrange BookmarkColor = BookMarkColorOrange
+	BookmarkColorRed    BookmarkColor = BookMarkColorRed
+)
+
+// Valid reports whether c is one of the bookmark colors supported by maltego.
+func (c BookmarkColor) Valid() bool {
+	switch c {
+	case BookmarkColorNone, BookmarkColorBlue, BookmarkColorGreen, BookmarkColorYellow, BookmarkColorOrange, BookmarkColorRed:
+		return true
+	default:
+		return false
+	}
+}
+
+// UIMessageType is the type of a UI message, which determines how maltego displays it.
+type UIMessageType string
+
+// UI message types
+const (
+	UIMessageTypeFatal        UIMessageType = UIMessageFatal
+	UIMessageTypePartialError UIMessageType = UIMessagePartialError
+	UIMessageTypeInform       UIMessageType = UIMessageInform
+	UIMessageTypeDebug        UIMessageType = UIMessageDebug
+)
+
+// Valid reports whether t is one of the UI message types supported by maltego.
+func (t UIMessageType) Valid() bool {
+	switch t {
+	case UIMessageTypeFatal, UIMessageTypePartialError, UIMessageTypeInform, UIMessageTypeDebug:
+		return true
+	default:
+		return false
+	}
+}
+
+// entity property types
+const (
+	PropertyTypeString   = "string"
+	PropertyTypeInt      = "int"
+	PropertyTypeFloat    = "float"
+	PropertyTypeBool     = "boolean"
+	PropertyTypeDate     = "date"
+	PropertyTypeDateTime = "datetime"
+	PropertyTypeColor    = "color"
+)
+
+// LinkLabelVisibility determines whether the label of a link is shown on the graph.
+type LinkLabelVisibility string
+
+// link label visibilities, used as values for the link#maltego.link.show-label property
+const (
+	// LinkLabelGlobal uses the global setting of the maltego client
+	LinkLabelGlobal LinkLabelVisibility = "0"
+
+	// LinkLabelShow always shows the label on the link
+	LinkLabelShow LinkLabelVisibility = "1"
+
+	// LinkLabelHide never shows the label on the link
+	LinkLabelHide LinkLabelVisibility = "2"
+)
+
 // LinkDirection determines the direction of node interconnections (links).
 type LinkDirection string
 
@@ -59,6 +129,7 @@ const (
 	LinkStyle             = "link#maltego.link.style"
 	LinkThickness         = "link#maltego.link.thickness"
 	Label                 = "link#maltego.link.label"
+	LinkShowLabel         = "link#maltego.link.show-label"
 	PropertyLinkDirection = "link#maltego.link.direction"
 	Bookmark              = "bookmark#"
 	Notes                 = "notes#"
@@ -0,0 +1,63 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import "net/http"
+
+// WithCORS wraps the handler to allow cross origin requests from the given origins, e.g. "https://example.com".
+// The origin "*" allows requests from any origin.
+// Preflight OPTIONS requests are answered directly, without invoking the handler.
+func WithCORS(next http.HandlerFunc, origins []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		allowed := origin != "" && allowedOrigin(origin, origins)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next(w, r)
+			return
+		}
+
+		// preflight request
+		if !allowed {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		headers := r.Header.Get("Access-Control-Request-Headers")
+		if headers == "" {
+			headers = "Content-Type"
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowedOrigin reports whether origin is contained in origins, or origins contains the wildcard "*".
+func allowedOrigin(origin string, origins []string) bool {
+	for _, o := range origins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
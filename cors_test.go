@@ -0,0 +1,77 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithCORS(t *testing.T) {
+	called := false
+	h := WithCORS(MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		called = true
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	}), []string{"https://ui.example.com"})
+
+	// preflight
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/run/test", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	h(rec, req)
+
+	if rec.Code != http.StatusNoContent || called {
+		t.Fatal("unexpected preflight response", rec.Code, called)
+	}
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://ui.example.com",
+		"Access-Control-Allow-Methods": "POST, OPTIONS",
+		"Access-Control-Allow-Headers": "content-type",
+	} {
+		if v := rec.Header().Get(header); v != expected {
+			t.Fatal("unexpected", header, v)
+		}
+	}
+
+	// preflight from another origin
+	rec = httptest.NewRecorder()
+	req.Header.Set("Origin", "https://evil.example.com")
+	h(rec, req)
+
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("unexpected preflight response for disallowed origin", rec.Code, rec.Header())
+	}
+
+	// the actual request
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest))
+	req.Header.Set("Origin", "https://ui.example.com")
+	h(rec, req)
+
+	if rec.Code != http.StatusOK || !called {
+		t.Fatal("unexpected response", rec.Code, called)
+	}
+	if v := rec.Header().Get("Access-Control-Allow-Origin"); v != "https://ui.example.com" {
+		t.Fatal("unexpected Access-Control-Allow-Origin", v)
+	}
+	if !strings.Contains(rec.Body.String(), "<Value>93.184.216.34</Value>") {
+		t.Fatal("unexpected response", rec.Body.String())
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sync"
+)
+
+// maxPooledEncoderSize is the buffer capacity above which encoders are not returned to the pool,
+// so that a single large response does not keep its memory allocated.
+const maxPooledEncoderSize = 1 << 20
+
+// encoder is an xml.Encoder that writes into its own buffer, it is reused for serializing transforms.
+type encoder struct {
+	buf bytes.Buffer
+	enc *xml.Encoder
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &encoder{}
+		e.enc = xml.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// encodeTransform serializes the transform like xml.Marshal, with a pooled encoder
+// whose buffer is grown to the estimated size of the output upfront.
+func encodeTransform(tr *Transform) (string, error) {
+	e := encoderPool.Get().(*encoder)
+
+	e.buf.Reset()
+	e.buf.Grow(sizeHint(tr))
+
+	if err := e.enc.Encode(tr); err != nil {
+		// the encoder may be left in an inconsistent state, do not reuse it
+		return "", err
+	}
+
+	out := e.buf.String()
+	if e.buf.Cap() <= maxPooledEncoderSize {
+		encoderPool.Put(e)
+	}
+
+	return out, nil
+}
+
+// sizeHint estimates the size of the serialized transform in bytes.
+func sizeHint(tr *Transform) int {
+	n := 64
+	if r := tr.ResponseMessage; r != nil {
+		n += 128
+		for _, ent := range r.Entities.Items {
+			if ent != nil {
+				n += entitySizeHint(ent)
+			}
+		}
+		for _, m := range r.UIMessages.Items {
+			if m != nil {
+				n += 48 + len(m.Text)
+			}
+		}
+	}
+	if ex := tr.ExceptionMessage; ex != nil {
+		n += 128
+		for _, x := range ex.Exceptions.Items {
+			if x != nil {
+				n += 40 + len(x.Text) + len(x.Code)
+			}
+		}
+	}
+	if r := tr.RequestMessage; r != nil {
+		n += 192
+		for _, ent := range r.Entities.Items {
+			if ent != nil {
+				n += entitySizeHint(ent)
+			}
+		}
+		for _, f := range r.TransformFields.Fields {
+			if f != nil {
+				n += 24 + len(f.Name) + len(f.Text)
+			}
+		}
+	}
+	return n
+}
+
+// entitySizeHint estimates the size of the serialized entity in bytes.
+func entitySizeHint(ent *Entity) int {
+	n := 64 + len(ent.Type) + len(ent.Value) + len(ent.Weight) + len(ent.IconURL)
+	if ent.Genealogy != nil {
+		n += 64 + len(ent.Genealogy.Type.Name) + len(ent.Genealogy.Type.OldName)
+	}
+	if ent.Info != nil {
+		n += 48
+		for _, l := range ent.Info.Labels {
+			if l != nil {
+				n += 48 + len(l.Name) + len(l.Type) + len(l.Text)
+			}
+		}
+	}
+	if ent.Fields != nil {
+		n += 40
+		for _, f := range ent.Fields.Items {
+			if f != nil {
+				n += 64 + len(f.MatchingRule) + len(f.Name) + len(f.DisplayName) + len(f.Text)
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,167 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"encoding/xml"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// compareEncoding checks that encodeTransform produces the same output as xml.Marshal.
+func compareEncoding(t *testing.T, tr *Transform) {
+	t.Helper()
+
+	exp, err := xml.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := encodeTransform(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, []byte(out), string(exp))
+}
+
+func TestEncodeTransform(t *testing.T) {
+	tricky := "a<b>&\"c'\td\ne\rf\x00g\xffh�i]]>j😀"
+
+	// empty messages
+	compareEncoding(t, &Transform{})
+	compareEncoding(t, &Transform{ResponseMessage: &ResponseMessage{}})
+	compareEncoding(t, &Transform{ExceptionMessage: &ExceptionMessage{}})
+	compareEncoding(t, &Transform{RequestMessage: &RequestMessage{}})
+
+	// response
+	trx := &Transform{}
+	e := trx.AddEntity("maltego.Domain", tricky)
+	e.Weight = tricky
+	e.Genealogy = &Genealogy{Type: GenealogyType{Name: tricky, OldName: tricky}}
+	e.AddProperty(tricky, tricky, tricky, tricky)
+	e.AddDisplaySection(tricky, tricky)
+	e.AddDisplaySection("empty", "")
+	e.IconURL = tricky
+	e.Info.Labels = append(e.Info.Labels, nil)
+	e.Fields.Items = append(e.Fields.Items, nil)
+	trx.AddEntity("maltego.Phrase", "")
+	trx.ResponseMessage.Entities.Items = append(trx.ResponseMessage.Entities.Items, nil, &Entity{Info: &DisplayInformation{}, Fields: &AdditionalFields{}})
+	trx.AddUIMessage(tricky, tricky)
+	trx.ResponseMessage.UIMessages.Items = append(trx.ResponseMessage.UIMessages.Items, nil)
+	compareEncoding(t, trx)
+
+	// exceptions
+	trx.AddException(tricky, tricky)
+	trx.ExceptionMessage.Exceptions.Items = append(trx.ExceptionMessage.Exceptions.Items, nil)
+	compareEncoding(t, trx)
+
+	// request
+	req := NewRequest()
+	req.RequestMessage.AddEntity(tricky, tricky).AddProp("fqdn", tricky)
+	req.RequestMessage.SetLimits(12, 256)
+	req.RequestMessage.Limits.SoftLimit = tricky
+	req.AddTransformField(tricky, tricky)
+	req.RequestMessage.TransformFields.Fields = append(req.RequestMessage.TransformFields.Fields, nil)
+	req.AddException("oops", "")
+	compareEncoding(t, req)
+
+	// parsed messages
+	for _, data := range []string{maltegoToTDS, tdsToMaltego} {
+		parsed := &Transform{}
+		if err := xml.Unmarshal([]byte(data), parsed); err != nil {
+			t.Fatal(err)
+		}
+		compareEncoding(t, parsed)
+	}
+}
+
+func TestEncodeTransformRandom(t *testing.T) {
+	var (
+		rnd   = rand.New(rand.NewSource(1))
+		runes = []rune{'a', 'Z', '0', ' ', '<', '>', '&', '"', '\'', '\t', '\n', '\r', ']', 0, 0x1F, 0xD7FF, 0xE000, 0xFFFD, 0xFFFE, 0x10000, 'ä', '😀'}
+	)
+
+	randomString := func() string {
+		b := make([]byte, 0, 32)
+		for i := rnd.Intn(16); i > 0; i-- {
+			if rnd.Intn(10) == 0 {
+				// invalid utf-8
+				b = append(b, byte(0x80+rnd.Intn(0x80)))
+				continue
+			}
+			b = append(b, string(runes[rnd.Intn(len(runes))])...)
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 200; i++ {
+		trx := &Transform{}
+		for j := rnd.Intn(5); j > 0; j-- {
+			e := trx.AddEntity(randomString(), randomString())
+			e.AddProperty(randomString(), randomString(), randomString(), randomString())
+			e.AddDisplaySection(randomString(), randomString())
+			e.IconURL = randomString()
+		}
+		trx.AddUIMessage(randomString(), randomString())
+		if rnd.Intn(2) == 0 {
+			trx.AddException(randomString(), randomString())
+		}
+		if rnd.Intn(2) == 0 {
+			trx.AddTransformField(randomString(), randomString())
+		}
+		compareEncoding(t, trx)
+	}
+}
+
+// largeTransform creates a response with n entities, each with a property and a link label.
+func largeTransform(n int) *Transform {
+	trx := &Transform{}
+	for i := 0; i < n; i++ {
+		e := trx.AddEntity("maltego.IPv4Address", "10.0."+strconv.Itoa(i/256)+"."+strconv.Itoa(i%256))
+		e.AddProp("ipv4-address", e.Value)
+		e.SetLinkLabel("resolves to")
+	}
+	trx.AddUIMessage("complete", UIMessageInform)
+	return trx
+}
+
+// BenchmarkReturnOutputLarge compares the serialization of 50k entities with xml.Marshal and ReturnOutput.
+//
+// Reference numbers, ReturnOutput saves the repeated growing of the output buffer:
+//
+//	xml.Marshal    430 ms/op   94 MB/op   550029 allocs/op
+//	ReturnOutput   265 ms/op   78 MB/op   550019 allocs/op
+func BenchmarkReturnOutputLarge(b *testing.B) {
+	trx := largeTransform(50000)
+
+	b.Run("xml.Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := xml.Marshal(trx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = string(data)
+		}
+	})
+
+	b.Run("ReturnOutput", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = trx.ReturnOutput()
+		}
+	})
+}
@@ -76,6 +76,31 @@ type MaltegoEntity struct {
 	Converter *Converter `xml:"Converter,omitempty"`
 }
 
+// SetValueField sets the name of the property that holds the value of the entity.
+func (e *MaltegoEntity) SetValueField(name string) {
+	e.Properties.Value = name
+}
+
+// SetDisplayValueField sets the name of the property that is displayed as label of the entity in the graph.
+func (e *MaltegoEntity) SetDisplayValueField(name string) {
+	e.Properties.DisplayValue = name
+}
+
+// SetBaseEntities sets the chain of entities the entity inherits from, starting with the direct parent.
+func (e *MaltegoEntity) SetBaseEntities(parents ...string) {
+	if len(parents) == 0 {
+		e.Entities = nil
+		return
+	}
+
+	e.Entities = &BaseEntities{}
+	for _, p := range parents {
+		e.Entities.Entities = append(e.Entities.Entities, BaseEntity{
+			Text: p,
+		})
+	}
+}
+
 // Converter contains information how to detect entities based on a regular expression.
 type Converter struct {
 	XMLName xml.Name    `xml:"Converter"`
@@ -98,8 +123,8 @@ type RegexGroup struct {
 
 // BaseEntities structure
 type BaseEntities struct {
-	Text     string `xml:",chardata"`
-	Entities []BaseEntity
+	Text     string       `xml:",chardata"`
+	Entities []BaseEntity `xml:"BaseEntity"`
 }
 
 // BaseEntity structure
@@ -118,21 +143,22 @@ type EntityProperties struct {
 
 // Fields hold property items.
 type Fields struct {
-	Items []*PropertyField
+	Items []*PropertyField `xml:"Field"`
 }
 
 // PropertyField are set on entities.
 type PropertyField struct {
-	XMLName     xml.Name `xml:"Field"`
-	Text        string   `xml:",chardata"`
-	Name        string   `xml:"name,attr"`
-	Type        string   `xml:"type,attr"`
-	Nullable    bool     `xml:"nullable,attr"`
-	Hidden      bool     `xml:"hidden,attr"`
-	Readonly    bool     `xml:"readonly,attr"`
-	Description string   `xml:"description,attr"`
-	DisplayName string   `xml:"displayName,attr"`
-	SampleValue string   `xml:"SampleValue"`
+	XMLName      xml.Name `xml:"Field"`
+	Text         string   `xml:",chardata"`
+	Name         string   `xml:"name,attr"`
+	Type         string   `xml:"type,attr"`
+	Nullable     bool     `xml:"nullable,attr"`
+	Hidden       bool     `xml:"hidden,attr"`
+	Readonly     bool     `xml:"readonly,attr"`
+	Description  string   `xml:"description,attr"`
+	DisplayName  string   `xml:"displayName,attr"`
+	DefaultValue string   `xml:"DefaultValue,omitempty"`
+	SampleValue  string   `xml:"SampleValue"`
 }
 
 // EntityCoreInfo describes an entity.
@@ -151,7 +177,7 @@ type EntityCoreInfoExtended struct {
 	Description string           `yaml:"description"`
 	Parent      string           `yaml:"parent"`
 	Fields      []*PropertyField `yaml:"fields"`
-	Image       *ImageInfos       `yaml:"image"`
+	Image       *ImageInfos      `yaml:"image"`
 }
 
 type ImageInfos struct {
@@ -16,6 +16,7 @@ package maltego
 import (
 	"encoding/xml"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -117,3 +118,129 @@ func TestToTransformDisplayName(t *testing.T) {
 		t.Fatal("unexpected result", res)
 	}
 }
+
+func TestPropertyFieldTypes(t *testing.T) {
+	for expected, f := range map[string]*PropertyField{
+		"string":   NewStringField("name", "a string"),
+		"int":      NewIntField("count", "an integer"),
+		"float":    NewFloatField("ratio", "a float"),
+		"boolean":  NewBoolField("active", "a boolean"),
+		"date":     NewDateField("created", "a date"),
+		"datetime": NewDateTimeField("seen", "a date time"),
+		"color":    NewColorField("tint", "a color"),
+	} {
+		data, err := xml.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(data), ` type="`+expected+`"`) {
+			t.Fatal("unexpected type attribute, expected", expected, "got", string(data))
+		}
+	}
+
+	if f := NewField("port", PropertyTypeInt, "a port"); f.Type != "int" || !f.Nullable {
+		t.Fatal("unexpected field", f)
+	}
+}
+
+func TestPropertyFieldDefaultValue(t *testing.T) {
+	data, err := xml.Marshal(NewFieldWithDefault("snaplen", PropertyTypeInt, "snap length", "1514"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "<DefaultValue>1514</DefaultValue><SampleValue></SampleValue>") {
+		t.Fatal("missing default value:", string(data))
+	}
+
+	data, err = xml.Marshal(NewIntField("snaplen", "snap length"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "DefaultValue") {
+		t.Fatal("unexpected default value:", string(data))
+	}
+}
+
+func TestPropertyFieldNamePreserved(t *testing.T) {
+	f := NewStringField("properties.dnsName", "The DNS name")
+	if f.Name != "properties.dnsName" {
+		t.Fatal("unexpected field name", f.Name)
+	}
+
+	f = NewRequiredStringField("properties.dnsName", "The DNS name")
+	if f.Name != "properties.dnsName" {
+		t.Fatal("unexpected required field name", f.Name)
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	for in, expected := range map[string]string{
+		"snap length":        "Snap Length",
+		"o'brien":            "O'brien",
+		"it’s a test":        "It’s A Test",
+		"élan vital":         "Élan Vital",
+		"ğüzel şehir":        "Ğüzel Şehir",
+		"properties.dnsName": "Properties.DnsName",
+		"":                   "",
+	} {
+		if res := titleCase(in); res != expected {
+			t.Fatal("unexpected result for", in, ":", res)
+		}
+	}
+
+	if f := NewStringField("o'brien", "a name"); f.DisplayName != "O'brien" {
+		t.Fatal("unexpected display name", f.DisplayName)
+	}
+}
+
+func TestNewMaltegoEntityRegex(t *testing.T) {
+	_, err := NewMaltegoEntityE("Test", "test", "test.", "properties.", "Interface", "", "A network interface", "", &RegexConversion{
+		Regex:      "^(eth[0-9+$",
+		Properties: []string{"properties.interface"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid regex")
+	}
+
+	e, err := NewMaltegoEntityE("Test", "test", "test.", "properties.", "Interface", "", "A network interface", "", &RegexConversion{
+		Regex:      "^(eth[0-9]+)$",
+		Properties: []string{"properties.interface"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Converter == nil || e.Converter.Value != "^(eth[0-9]+)$" {
+		t.Fatal("unexpected converter", e.Converter)
+	}
+}
+
+func TestNewRegexConversion(t *testing.T) {
+	conv, err := NewRegexConversion(map[string]string{
+		"iface": "properties.interface",
+		"mac":   "properties.mac",
+	}, `^(?P<iface>eth[0-9]+)$`, `^(?P<iface>[a-z]+[0-9]*)\((?P<mac>[0-9a-f:]+)\)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewMaltegoEntityE("Test", "test", "test.", "properties.", "Interface", "", "A network interface", "", conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := xml.Marshal(e.Converter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<Converter><Value>(?:^(eth[0-9]+)$)|(?:^([a-z]+[0-9]*)\(([0-9a-f:]+)\)$)</Value><RegexGroups><RegexGroup property="properties.interface"></RegexGroup><RegexGroup property="properties.interface"></RegexGroup><RegexGroup property="properties.mac"></RegexGroup></RegexGroups></Converter>`
+	compareGeneratedXML(data, expected, t)
+
+	if _, err = NewRegexConversion(nil, `^(?P<iface>eth[0-9]+)$`); err == nil {
+		t.Fatal("expected an error for an unmapped capture group")
+	}
+}
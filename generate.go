@@ -15,20 +15,36 @@ package maltego
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"image/color"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// NewMaltegoEntity creates a new entity model for the given parameters.
 func NewMaltegoEntity(category, ident, prefix, propsPrefix, entName, imgName, description, parent string, r *RegexConversion, propertyFields ...*PropertyField) MaltegoEntity {
+	ent, err := NewMaltegoEntityE(category, ident, prefix, propsPrefix, entName, imgName, description, parent, r, propertyFields...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return ent
+}
+
+// NewMaltegoEntityE is the error returning variant of NewMaltegoEntity.
+// An error is returned if the regular expression of the conversion is invalid.
+func NewMaltegoEntityE(category, ident, prefix, propsPrefix, entName, imgName, description, parent string, r *RegexConversion, propertyFields ...*PropertyField) (MaltegoEntity, error) {
 
 	if imgName != "" {
 		if !strings.Contains(imgName, "/") {
@@ -55,7 +71,7 @@ func NewMaltegoEntity(category, ident, prefix, propsPrefix, entName, imgName, de
 					Items: []*PropertyField{
 						{
 							Name:        propsPrefix + strings.ToLower(entName),
-							Type:        "string",
+							Type:        PropertyTypeString,
 							Nullable:    true,
 							Hidden:      false,
 							Readonly:    false,
@@ -71,7 +87,9 @@ func NewMaltegoEntity(category, ident, prefix, propsPrefix, entName, imgName, de
 
 	if r != nil {
 		// make sure the regex is valid
-		_ = regexp.MustCompile(r.Regex)
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			return MaltegoEntity{}, fmt.Errorf("invalid regex conversion for entity %s: %w", name, err)
+		}
 
 		// set converter
 		ent.Converter = &Converter{
@@ -93,114 +111,448 @@ func NewMaltegoEntity(category, ident, prefix, propsPrefix, entName, imgName, de
 	}
 
 	if len(parent) > 0 {
-		ent.Entities = &BaseEntities{
-			Entities: []BaseEntity{
-				{
-					Text: parent,
-				},
-			},
+		ent.SetBaseEntities(parent)
+	}
+
+	return ent, nil
+}
+
+// NewRegexConversion combines multiple regular expressions into a single conversion,
+// so that an entity can be detected from different patterns.
+// The named capture groups (?P<name>...) of all expressions are mapped to the properties in groups,
+// unnamed capture groups are not mapped to a property.
+func NewRegexConversion(groups map[string]string, regexes ...string) (*RegexConversion, error) {
+	var (
+		conv         = &RegexConversion{}
+		alternatives = make([]string, 0, len(regexes))
+	)
+
+	for _, expr := range regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
 		}
+
+		// collect the properties in the order of the capture groups
+		for _, name := range re.SubexpNames()[1:] {
+			if name == "" {
+				conv.Properties = append(conv.Properties, "")
+				continue
+			}
+
+			prop, ok := groups[name]
+			if !ok {
+				return nil, fmt.Errorf("no property for capture group %q in %s", name, expr)
+			}
+			conv.Properties = append(conv.Properties, prop)
+		}
+
+		// group names must be unique in the combined expression, so they are removed
+		alternatives = append(alternatives, "(?:"+stripGroupNames(expr)+")")
 	}
 
-	return ent
+	conv.Regex = strings.Join(alternatives, "|")
+
+	return conv, nil
 }
 
-func NewStringField(name string, description string) *PropertyField {
+// stripGroupNames turns all named capture groups in expr into unnamed capture groups.
+func stripGroupNames(expr string) string {
+	var (
+		b       strings.Builder
+		escaped bool
+		class   bool
+	)
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(':
+			if n := namedGroupPrefix(expr[i+1:]); n > 0 {
+				b.WriteByte('(')
+				i += n
+				continue
+			}
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// namedGroupPrefix returns the length of the group name declaration "?P<name>" or "?<name>" at the start of s,
+// or 0 if s does not start with one.
+func namedGroupPrefix(s string) int {
+	switch {
+	case strings.HasPrefix(s, "?P<"):
+	case strings.HasPrefix(s, "?<") && !strings.HasPrefix(s, "?<=") && !strings.HasPrefix(s, "?<!"):
+	default:
+		return 0
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end == -1 {
+		return 0
+	}
+
+	return end + 1
+}
+
+// NewField creates an optional entity property field of the given type.
+// The name is used as provided, since property names are case sensitive, only the display name is title cased.
+func NewField(name, typ, description string) *PropertyField {
 	return &PropertyField{
-		Name:        strings.ToLower(name),
-		Type:        "string",
+		Name:        name,
+		Type:        typ,
 		Nullable:    true,
 		Hidden:      false,
 		Readonly:    false,
 		Description: description,
-		DisplayName: strings.Title(name),
+		DisplayName: titleCase(name),
 		SampleValue: "",
 	}
 }
 
+// NewFieldWithDefault creates an optional entity property field of the given type with a default value.
+func NewFieldWithDefault(name, typ, description, defaultValue string) *PropertyField {
+	f := NewField(name, typ, description)
+	f.DefaultValue = defaultValue
+
+	return f
+}
+
+// NewStringField creates an optional string property field.
+func NewStringField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeString, description)
+}
+
+// NewRequiredStringField creates a string property field that must be set.
 func NewRequiredStringField(name string, description string) *PropertyField {
-	return &PropertyField{
-		Name:        strings.ToLower(name),
-		Type:        "string",
-		Nullable:    false,
-		Hidden:      false,
-		Readonly:    false,
-		Description: description,
-		DisplayName: strings.Title(name),
-		SampleValue: "",
-	}
+	f := NewField(name, PropertyTypeString, description)
+	f.Nullable = false
+
+	return f
 }
 
-// TODO: add config struct with defaults
+// NewIntField creates an optional integer property field.
+func NewIntField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeInt, description)
+}
+
+// NewFloatField creates an optional floating point property field.
+func NewFloatField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeFloat, description)
+}
+
+// NewBoolField creates an optional boolean property field.
+func NewBoolField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeBool, description)
+}
+
+// NewDateField creates an optional date property field.
+func NewDateField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeDate, description)
+}
+
+// NewDateTimeField creates an optional date time property field.
+func NewDateTimeField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeDateTime, description)
+}
+
+// NewColorField creates an optional color property field.
+func NewColorField(name string, description string) *PropertyField {
+	return NewField(name, PropertyTypeColor, description)
+}
+
+// GenEntityConfig bundles the parameters for generating an entity.
+type GenEntityConfig struct {
+
+	// IconRoot is the directory that contains the IconSet directory.
+	IconRoot string
+
+	// IconSet is the directory below IconRoot to copy icons from, defaults to DefaultIconSet.
+	IconSet string
+
+	Category    string
+	Ident       string
+	Prefix      string
+	PropsPrefix string
+	OutDir      string
+	Name        string
+	Icon        string
+	Description string
+	Parent      string
+	Color       string
+	Regex       *RegexConversion
+	Fields      []*PropertyField
+
+	// Parents are additional base entities, that are inherited from after Parent.
+	Parents []string
+
+	// DisplayValueField is the property displayed as label of the entity,
+	// defaults to the value property of the entity.
+	DisplayValueField string
+
+	// IconColor recolors the monochrome icon files for Icon at generation time,
+	// instead of copying the pre-colored icon files for Icon and Color.
+	IconColor color.Color
+
+	// FailOnMissingIcons fails the generation with an error wrapping fs.ErrNotExist if an icon size variant is missing,
+	// instead of skipping it with a warning.
+	FailOnMissingIcons bool
+}
+
+// GenEntity will generate the entity file and copy its icons into outDir.
+// It is a wrapper for GenEntityFromConfig.
 func GenEntity(path string, category, ident, prefix, propsPrefix, outDir string, entName string, imgName string, description string, parent string, color string, regex *RegexConversion, fields ...*PropertyField) {
+	err := GenEntityE(path, category, ident, prefix, propsPrefix, outDir, entName, imgName, description, parent, color, regex, fields...)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	if imgName != "" {
-		imgName = imgName + "_" + color
+// GenEntityE is the error returning variant of GenEntity.
+func GenEntityE(path string, category, ident, prefix, propsPrefix, outDir string, entName string, imgName string, description string, parent string, color string, regex *RegexConversion, fields ...*PropertyField) error {
+	return GenEntityFromConfigE(GenEntityConfig{
+		IconRoot:    path,
+		Category:    category,
+		Ident:       ident,
+		Prefix:      prefix,
+		PropsPrefix: propsPrefix,
+		OutDir:      outDir,
+		Name:        entName,
+		Icon:        imgName,
+		Description: description,
+		Parent:      parent,
+		Color:       color,
+		Regex:       regex,
+		Fields:      fields,
+	})
+}
+
+// GenEntityFromConfig will generate the entity file and copy its icons into cfg.OutDir.
+func GenEntityFromConfig(cfg GenEntityConfig) {
+	if err := GenEntityFromConfigE(cfg); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	var (
-		name = prefix + entName
-		ent  = NewMaltegoEntity(category, ident, prefix, propsPrefix, entName, imgName, description, parent, regex, fields...)
-	)
+// GenEntityFromConfigE is the error returning variant of GenEntityFromConfig.
+func GenEntityFromConfigE(cfg GenEntityConfig) error {
+	root := cfg.IconRoot
+	if root == "" {
+		root = "."
+	}
 
-	data, err := xml.MarshalIndent(ent, "", " ")
-	if err != nil {
+	return GenEntityFSE(os.DirFS(root), cfg)
+}
+
+// GenEntityFS will generate the entity file and copy its icons from the src filesystem into cfg.OutDir.
+// Icons are looked up in the cfg.IconSet directory of src, cfg.IconRoot is ignored.
+// This allows to embed the icons into the generator via go:embed.
+func GenEntityFS(src fs.FS, cfg GenEntityConfig) {
+	if err := GenEntityFSE(src, cfg); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// GenEntityFSE is the error returning variant of GenEntityFS.
+func GenEntityFSE(src fs.FS, cfg GenEntityConfig) error {
+
+	imgName := cfg.Icon
+	if imgName != "" && cfg.Color != "" {
+		imgName = imgName + "_" + cfg.Color
+	}
 
-	f, err := os.Create(filepath.Join(outDir, "Entities", name+".entity"))
+	if cfg.IconSet == "" {
+		cfg.IconSet = DefaultIconSet
+	}
+
+	name := cfg.Prefix + cfg.Name
+
+	ent, err := NewMaltegoEntityE(cfg.Category, cfg.Ident, cfg.Prefix, cfg.PropsPrefix, cfg.Name, imgName, cfg.Description, cfg.Parent, cfg.Regex, cfg.Fields...)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	_, err = f.Write(data)
+	if len(cfg.Parents) > 0 {
+		parents := cfg.Parents
+		if cfg.Parent != "" {
+			parents = append([]string{cfg.Parent}, parents...)
+		}
+		ent.SetBaseEntities(parents...)
+	}
+
+	if cfg.DisplayValueField != "" {
+		ent.SetDisplayValueField(cfg.DisplayValueField)
+	}
+
+	data, err := xml.MarshalIndent(ent, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal entity %s: %w", name, err)
 	}
 
-	err = f.Close()
+	err = writeFile(filepath.Join(cfg.OutDir, "Entities", name+".entity"), data)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	if imgName != "" {
+		if cfg.IconColor != nil {
+			return copyIcons(src, cfg.IconSet, cfg.Ident, cfg.Icon, imgName, cfg.OutDir, cfg.IconColor, cfg.FailOnMissingIcons)
+		}
+		return copyIcons(src, cfg.IconSet, cfg.Ident, imgName, imgName, cfg.OutDir, nil, cfg.FailOnMissingIcons)
+	}
+
+	return nil
+}
+
+// DefaultIconSet is the name of the directory below the icon root that contains the icon files,
+// if no icon set has been configured.
+const DefaultIconSet = "renamed"
 
-		// add icon files
-		_ = os.MkdirAll(filepath.Join(outDir, "Icons", ident), 0o700)
+// iconSizes are the size variants that are copied for each icon.
+var iconSizes = []string{"16", "24", "32", "48", "96"}
 
+// copyIcons copies the icon files for imgName from the set directory in src into the Icons directory for ident in outDir,
+// where they are stored as dstName. If recolor is not nil, the icon images are recolored while copying.
+// Missing icon files are skipped with a warning, or reported with an error wrapping fs.ErrNotExist if failMissing is set.
+// A missing XML meta file will be generated.
+// If there are no size variants but a single scalable svg file, only that file will be copied.
+func copyIcons(src fs.FS, set, ident, imgName, dstName, outDir string, recolor color.Color, failMissing bool) error {
+
+	// add icon files
+	err := os.MkdirAll(filepath.Join(outDir, "Icons", ident), 0o700)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ext     = ".svg"
+		base    = path.Join(set, imgName)
+		dstBase = filepath.Join(outDir, "Icons", ident, dstName)
+	)
+
+	// try to determine image type: first try svg, then if failed assume png
+	if _, err = fs.Stat(src, base+"16"+ext); err != nil {
+		ext = ".png"
+	}
+
+	// copy xml icon meta file, or create it if there is none
+	if _, err = fs.Stat(src, base+".xml"); err != nil {
+		err = CreateXMLIconFileE(dstBase)
+	} else {
+		err = copyFileFS(src, base+".xml", dstBase+".xml")
+	}
+	if err != nil {
+		return err
+	}
+
+	// scalable icon sets may only provide a single svg without size variants
+	if _, err = fs.Stat(src, base+"16.svg"); err != nil {
+		if _, err = fs.Stat(src, base+".svg"); err == nil {
+			return copyIconFS(src, base+".svg", dstBase+".svg", recolor)
+		}
+	}
+
+	for _, size := range iconSizes {
 		var (
-			ext  = ".svg"
-			base = filepath.Join(path, "renamed", imgName)
+			name = base + size + ext
+			dst  = dstBase + size + ext
 		)
+		if size == "16" {
+			dst = dstBase + ext
+		}
+
+		if _, err = fs.Stat(src, name); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if failMissing {
+				return fmt.Errorf("missing icon file: %w", err)
+			}
+			fmt.Println("warning: skipping missing icon file", name)
+			continue
+		}
 
-		// try to determine image type: first try svg, then if failed assume png
-		if _, err = os.Stat(base + "16" + ext); err != nil {
-			ext = ".png"
-			base = filepath.Join(path, "renamed", imgName)
+		err = copyIconFS(src, name, dst, recolor)
+		if err != nil {
+			return err
 		}
+	}
 
-		dstBase := filepath.Join(outDir, "Icons", ident, imgName)
+	return nil
+}
 
-		// copy xml icon meta file
-		CopyFile(
-			filepath.Join(path, "renamed", imgName+".xml"),
-			filepath.Join(outDir, "Icons", ident, imgName+".xml"),
-		)
+// copyIconFS copies the icon image with the given name from src to the dst path on disk,
+// recoloring it if recolor is not nil.
+func copyIconFS(src fs.FS, name, dst string, recolor color.Color) error {
+	if recolor == nil {
+		return copyFileFS(src, name, dst)
+	}
+
+	data, err := fs.ReadFile(src, name)
+	if err != nil {
+		return err
+	}
 
-		CopyFile(base+"16"+ext, dstBase+ext)
-		CopyFile(base+"24"+ext, dstBase+"24"+ext)
-		CopyFile(base+"32"+ext, dstBase+"32"+ext)
-		CopyFile(base+"48"+ext, dstBase+"48"+ext)
-		CopyFile(base+"96"+ext, dstBase+"96"+ext)
+	data, err = recolorIcon(data, path.Ext(name), recolor)
+	if err != nil {
+		return fmt.Errorf("failed to recolor icon %s: %w", name, err)
 	}
+
+	return writeFile(dst, data)
+}
+
+// copyFileFS copies the file with the given name from src to the dst path on disk.
+func copyFileFS(src fs.FS, name, dst string) error {
+	data, err := fs.ReadFile(src, name)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(dst, data)
+}
+
+// writeFile creates the file at path and writes data into it.
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
 }
 
 // CopyFile the source file contents to destination
 // file attributes wont be copied and an existing file will be overwritten.
 func CopyFile(src, dst string) {
+	if err := CopyFileE(src, dst); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// CopyFileE is the error returning variant of CopyFile.
+func CopyFileE(src, dst string) error {
 	in, err := os.Open(src)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	defer func() {
@@ -211,18 +563,16 @@ func CopyFile(src, dst string) {
 
 	out, err := os.Create(dst)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	_, err = io.Copy(out, in)
 	if err != nil {
-		log.Fatal(err)
+		_ = out.Close()
+		return err
 	}
 
-	err = out.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return out.Close()
 }
 
 // GenEntityArchive will generate a configuration archive for maltego entities.
@@ -244,58 +594,277 @@ func CopyFile(src, dst string) {
 //     │           └── sim_card_alert96.png
 //     └── version.properties.
 func GenEntityArchive(entityCategory string) {
+	if err := GenEntityArchiveE(entityCategory); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// GenEntityArchiveE is the error returning variant of GenEntityArchive.
+func GenEntityArchiveE(entityCategory string) error {
+	return GenEntityArchiveWithOptions(entityCategory, ArchiveOptions{})
+}
+
+// GenEntityArchiveWithOptions generates the configuration archive for maltego entities like GenEntityArchive,
+// using the provided options.
+func GenEntityArchiveWithOptions(entityCategory string, opts ArchiveOptions) error {
 	// clean
 	_ = os.RemoveAll("entities")
 
 	// create directories
-	_ = os.MkdirAll("entities/Entities", 0o700)
-	_ = os.MkdirAll("entities/EntityCategories", 0o700)
-	_ = os.MkdirAll("entities/Icons", 0o700)
+	for _, dir := range []string{"entities/Entities", "entities/EntityCategories", "entities/Icons"} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
 
-	fVersion, err := os.Create("entities/version.properties")
+	v, err := opts.version()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer func() {
-		if errClose := fVersion.Close(); errClose != nil {
-			fmt.Println(errClose)
-		}
-	}()
+	err = writeVersionProperties("entities", v)
+	if err != nil {
+		return err
+	}
 
-	fCategory, err := os.Create("entities/EntityCategories/" + entityCategory + ".category")
+	err = writeEntityCategory(filepath.Join("entities", "EntityCategories", categoryFileName(entityCategory)+".category"), entityCategory)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer func() {
-		if errClose := fCategory.Close(); errClose != nil {
-			fmt.Println(errClose)
-		}
-	}()
+	fmt.Println("generated maltego entity archive")
 
-	_, _ = fVersion.WriteString(`#
-#` + time.Now().Format(time.UnixDate) + `
-client.version=4.2.12
-client.subtitle=
-pandora.version=1.4.2
-client.name=Maltego Classic Eval
-mtz.version=1.0
-graph.version=1.2`)
+	return nil
+}
 
-	_, _ = fCategory.WriteString("<EntityCategory name=\"" + entityCategory + "\"/>")
+// writeEntityCategory writes the entity category file at path.
+// The category name is used as provided, without any case normalization, but escaped for XML.
+func writeEntityCategory(path, category string) error {
+	var b bytes.Buffer
 
-	fmt.Println("generated maltego entity archive")
+	b.WriteString(`<EntityCategory name="`)
+	if err := xml.EscapeText(&b, []byte(category)); err != nil {
+		return err
+	}
+	b.WriteString(`"/>`)
+
+	return writeFile(path, b.Bytes())
 }
 
+// PackEntityArchive will zip the entities directory into entities.mtz.
 func PackEntityArchive() {
+	if err := PackEntityArchiveE(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// PackEntityArchiveE is the error returning variant of PackEntityArchive.
+func PackEntityArchiveE() error {
 	fmt.Println("packing maltego entity archive")
 
 	// zip and rename to: entities.mtz
-	f, err := os.Create("entities" + configFileExtension)
+	err := packArchive("entities", "entities"+configFileExtension, ArchiveOptions{})
 	if err != nil {
+		return err
+	}
+
+	fmt.Println("packed maltego entity archive")
+
+	return nil
+}
+
+// ArchiveConfig configures the generation of an entity archive with GenEntitiesArchive.
+type ArchiveConfig struct {
+
+	// Dir is the directory the contents of the archive are generated in, defaults to "entities".
+	// It is removed before the generation.
+	Dir string
+
+	// Archive is the path of the packed archive, defaults to Dir with the .mtz extension.
+	Archive string
+
+	// Category is the entity category of the generated entities.
+	Category    string
+	Ident       string
+	Prefix      string
+	PropsPrefix string
+
+	// Icons is the filesystem the icons are copied from, defaults to the current directory.
+	Icons fs.FS
+
+	// IconSet is the directory in Icons to copy icons from, defaults to DefaultIconSet.
+	IconSet string
+
+	// FailOnMissingIcons fails the generation if an icon size variant is missing, see GenEntityConfig.
+	FailOnMissingIcons bool
+
+	ArchiveOptions
+}
+
+// dir returns the directory the contents of the archive are generated in.
+func (c ArchiveConfig) dir() string {
+	if c.Dir == "" {
+		return "entities"
+	}
+	return c.Dir
+}
+
+// icons returns the filesystem the icons are copied from.
+func (c ArchiveConfig) icons() fs.FS {
+	if c.Icons == nil {
+		return os.DirFS(".")
+	}
+	return c.Icons
+}
+
+// entityConfig returns the configuration for generating the entity described by info into the archive.
+func (c ArchiveConfig) entityConfig(info EntityCoreInfo) GenEntityConfig {
+	return GenEntityConfig{
+		IconSet:     c.IconSet,
+		Category:    c.Category,
+		Ident:       c.Ident,
+		Prefix:      c.Prefix,
+		PropsPrefix: c.PropsPrefix,
+		OutDir:      c.dir(),
+		Name:        info.Name,
+		Icon:        info.Icon,
+		Description: info.Description,
+		Parent:      info.Parent,
+		Fields:      info.Fields,
+
+		FailOnMissingIcons: c.FailOnMissingIcons,
+	}
+}
+
+// GenEntityFromCoreInfo will generate the entity described by info into the archive directory of cfg
+// and copy its icons. The directory structure must already exist, e.g. created by GenEntityArchive.
+func GenEntityFromCoreInfo(cfg ArchiveConfig, info EntityCoreInfo) {
+	if err := GenEntityFromCoreInfoE(cfg, info); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// GenEntityFromCoreInfoE is the error returning variant of GenEntityFromCoreInfo.
+func GenEntityFromCoreInfoE(cfg ArchiveConfig, info EntityCoreInfo) error {
+	return GenEntityFSE(cfg.icons(), cfg.entityConfig(info))
+}
+
+// GenEntitiesArchive generates the configuration archive for the provided entities in one step.
+// It creates the archive directory with the entity category and version.properties,
+// generates the entity files and copies their icons, and packs the directory into the archive.
+func GenEntitiesArchive(cfg ArchiveConfig, entities []EntityCoreInfo) error {
+	dir := cfg.dir()
+
+	// clean
+	_ = os.RemoveAll(dir)
+
+	// create directories
+	for _, d := range []string{"Entities", "EntityCategories", "Icons"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o700); err != nil {
+			return err
+		}
+	}
+
+	v, err := cfg.version()
+	if err != nil {
+		return err
+	}
+
+	err = writeVersionProperties(dir, v)
+	if err != nil {
+		return err
+	}
+
+	err = writeEntityCategory(filepath.Join(dir, "EntityCategories", categoryFileName(cfg.Category)+".category"), cfg.Category)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range entities {
+		err = GenEntityFromCoreInfoE(cfg, info)
+		if err != nil {
+			return fmt.Errorf("failed to generate entity %s: %w", info.Name, err)
+		}
+	}
+
+	archive := cfg.Archive
+	if archive == "" {
+		archive = dir + configFileExtension
+	}
+
+	return packArchive(dir, archive, cfg.ArchiveOptions)
+}
+
+// ArchiveOptions configure the generation and packing of archives.
+type ArchiveOptions struct {
+
+	// ModTime is used as modification time for all zip entries and as timestamp in version.properties.
+	// If unset, the SOURCE_DATE_EPOCH environment variable will be used if present, otherwise the current time.
+	// An invalid SOURCE_DATE_EPOCH fails the generation.
+	ModTime time.Time
+
+	// Version is written into version.properties, empty fields default to the values of DefaultVersionInfo.
+	// If its timestamp is unset, the timestamp is determined like for ModTime.
+	Version VersionInfo
+}
+
+// version returns the version information for the version.properties of the archive.
+func (o ArchiveOptions) version() (VersionInfo, error) {
+	var (
+		v   = o.Version
+		def = DefaultVersionInfo()
+	)
+
+	// fill each empty field separately, maltego rejects archives with empty versions
+	setDefault(&v.ClientName, def.ClientName)
+	setDefault(&v.ClientVersion, def.ClientVersion)
+	setDefault(&v.ClientSubtitle, def.ClientSubtitle)
+	setDefault(&v.PandoraVersion, def.PandoraVersion)
+	setDefault(&v.MtzVersion, def.MtzVersion)
+	setDefault(&v.GraphVersion, def.GraphVersion)
+
+	if v.Timestamp.IsZero() {
+		ts, err := o.timestamp()
+		if err != nil {
+			return v, err
+		}
+		v.Timestamp = ts
+	}
+
+	return v, nil
+}
+
+// setDefault sets val to def if it is empty.
+func setDefault(val *string, def string) {
+	if *val == "" {
+		*val = def
+	}
+}
+
+// timestamp returns the time to use for generated files.
+// An invalid SOURCE_DATE_EPOCH is reported as error.
+func (o ArchiveOptions) timestamp() (time.Time, error) {
+	if !o.ModTime.IsZero() {
+		return o.ModTime.UTC(), nil
+	}
+
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+
+	return time.Now(), nil
+}
+
+// packArchive zips the contents of the directory at dir into a new archive at dst.
+func packArchive(dir, dst string, opts ArchiveOptions) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		errClose := f.Close()
 		if errClose != nil && !errors.Is(errClose, io.EOF) {
@@ -303,54 +872,99 @@ func PackEntityArchive() {
 		}
 	}()
 
-	w := zip.NewWriter(f)
+	return zipDir(f, dir, opts)
+}
 
-	// add files to the archive
-	addFiles(w, "entities", "")
+// ZipDir writes a zip archive with the contents of dir to w.
+// Entries are named relative to dir, use forward slashes as separator
+// and are added sorted by name with a fixed modification time, so the same directory always produces the same archive.
+// The modification time is taken from the SOURCE_DATE_EPOCH environment variable if present, otherwise it is zipEpoch.
+func ZipDir(w io.Writer, dir string) error {
+	opts := ArchiveOptions{}
+	if os.Getenv("SOURCE_DATE_EPOCH") == "" {
+		opts.ModTime = zipEpoch
+	}
+
+	return zipDir(w, dir, opts)
+}
+
+// zipEpoch is the earliest modification time that can be represented in a zip archive.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// zipDir writes a zip archive with the contents of dir to w.
+func zipDir(w io.Writer, dir string, opts ArchiveOptions) error {
+	zw := zip.NewWriter(w)
 
-	err = w.Flush()
+	modTime, err := opts.timestamp()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = w.Close()
+	// add files to the archive
+	err = addFiles(zw, dir, "", modTime)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	fmt.Println("packed maltego entity archive")
+	return zw.Close()
+}
+
+// createEntry adds a new entry with the given name and modification time to the archive.
+func createEntry(wr *zip.Writer, name string, modTime time.Time) (io.Writer, error) {
+	return wr.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
 }
 
-func addFiles(wr *zip.Writer, basePath, baseInZip string) {
-	files, err := ioutil.ReadDir(basePath)
+// addFiles adds the contents of basePath recursively to the archive below baseInZip.
+// Zip entries always use forward slashes as separator, regardless of the operating system.
+// Directory entries are added sorted by name, so the archive layout is stable across platforms.
+func addFiles(wr *zip.Writer, basePath, baseInZip string, modTime time.Time) error {
+	// ReadDir returns the entries sorted by filename
+	files, err := os.ReadDir(basePath)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
+	baseInZip = filepath.ToSlash(baseInZip)
+
 	for _, file := range files {
-		path := filepath.Join(basePath, file.Name())
-		//fmt.Println(path)
+		var (
+			filePath = filepath.Join(basePath, file.Name())
+			zipPath  = path.Join(baseInZip, file.Name())
+		)
 
 		if !file.IsDir() {
-			data, errRead := ioutil.ReadFile(path)
+			data, errRead := os.ReadFile(filePath)
 			if errRead != nil {
-				fmt.Println(errRead)
+				return errRead
 			}
 
 			// add files to the archive
-			f, errCreate := wr.Create(filepath.Join(baseInZip, file.Name()))
+			f, errCreate := createEntry(wr, zipPath, modTime)
 			if errCreate != nil {
-				log.Fatal(errCreate)
+				return errCreate
 			}
 
 			_, err = f.Write(data)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 		} else {
-			newBase := filepath.Join(basePath, file.Name(), "/")
-			//fmt.Println("adding sub directory: " + newBase)
-			addFiles(wr, newBase, filepath.Join(baseInZip, file.Name(), "/"))
+			// add an explicit directory entry, so that empty directories are preserved
+			_, err = createEntry(wr, zipPath+"/", modTime)
+			if err != nil {
+				return err
+			}
+
+			err = addFiles(wr, filePath, zipPath, modTime)
+			if err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,1438 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestGenerateReturnsErrors(t *testing.T) {
+	// a directory that does not exist inside a fresh temp dir cannot be written to
+	outDir := filepath.Join(t.TempDir(), "does", "not", "exist")
+
+	err := GenEntityE("", "Test", "test", "test.", "properties.", outDir, "Entity", "", "A test entity", "", "", nil)
+	if err == nil {
+		t.Fatal("expected an error from GenEntityE")
+	}
+
+	err = GenTransformE("/", "Org", "Author", "test.", outDir, "ToTest", "A test transform", "test.Entity", "test", nil, false)
+	if err == nil {
+		t.Fatal("expected an error from GenTransformE")
+	}
+
+	err = GenServerListingE("test.", outDir, []*TransformCoreInfo{{ID: "ToTest"}})
+	if err == nil {
+		t.Fatal("expected an error from GenServerListingE")
+	}
+
+	err = PackMaltegoArchiveE(outDir)
+	if err == nil {
+		t.Fatal("expected an error from PackMaltegoArchiveE")
+	}
+
+	err = CopyFileE(filepath.Join(outDir, "src"), filepath.Join(outDir, "dst"))
+	if err == nil {
+		t.Fatal("expected an error from CopyFileE")
+	}
+}
+
+func TestGenEntityIconRoot(t *testing.T) {
+	var (
+		root   = t.TempDir()
+		outDir = t.TempDir()
+	)
+
+	if err := os.MkdirAll(filepath.Join(root, "custom"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	// only provide some of the sizes, the missing ones must be skipped
+	for _, size := range []string{"16", "24", "32"} {
+		if err := os.WriteFile(filepath.Join(root, "custom", "router_red"+size+".png"), []byte("png"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := GenEntityFromConfigE(GenEntityConfig{
+		IconRoot:    root,
+		IconSet:     "custom",
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		OutDir:      outDir,
+		Name:        "Interface",
+		Icon:        "router",
+		Description: "A network interface",
+		Color:       "red",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"router_red.xml", "router_red.png", "router_red24.png", "router_red32.png"} {
+		if _, err = os.Stat(filepath.Join(outDir, "Icons", "test", name)); err != nil {
+			t.Fatal("expected icon file", name, err)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(outDir, "Icons", "test", "router_red48.png")); err == nil {
+		t.Fatal("unexpected icon file router_red48.png")
+	}
+}
+
+func TestGenEntityFailOnMissingIcons(t *testing.T) {
+	var (
+		root   = t.TempDir()
+		outDir = t.TempDir()
+	)
+
+	if err := os.MkdirAll(filepath.Join(root, "custom"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "custom", "router16.png"), []byte("png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenEntityFromConfigE(GenEntityConfig{
+		IconRoot:           root,
+		IconSet:            "custom",
+		Category:           "Test",
+		Ident:              "test",
+		Prefix:             "test.",
+		PropsPrefix:        "properties.",
+		OutDir:             outDir,
+		Name:               "Interface",
+		Icon:               "router",
+		Description:        "A network interface",
+		FailOnMissingIcons: true,
+	})
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "router24.png") {
+		t.Fatal("expected missing icon error, got", err)
+	}
+}
+
+func TestGenEntityFromConfig(t *testing.T) {
+	var (
+		positionalDir = t.TempDir()
+		configDir     = t.TempDir()
+		fields        = []*PropertyField{NewStringField("snaplen", "snap length for ethernet frames in bytes")}
+		regex         = &RegexConversion{Regex: "^(eth[0-9]+)$", Properties: []string{"properties.interface"}}
+	)
+
+	for _, dir := range []string{positionalDir, configDir} {
+		if err := os.MkdirAll(filepath.Join(dir, "Entities"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := GenEntityE("", "Test", "test", "test.", "properties.", positionalDir, "Interface", "", "A network interface", "maltego.Device", "", regex, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = GenEntityFromConfigE(GenEntityConfig{
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		OutDir:      configDir,
+		Name:        "Interface",
+		Description: "A network interface",
+		Parent:      "maltego.Device",
+		Regex:       regex,
+		Fields:      fields,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(filepath.Join(positionalDir, "Entities", "test.Interface.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "Entities", "test.Interface.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGeneratedXML(data, string(expected), t)
+}
+
+func TestGenEntitySVGOnlyIcon(t *testing.T) {
+	var (
+		root   = t.TempDir()
+		outDir = t.TempDir()
+	)
+
+	if err := os.MkdirAll(filepath.Join(root, DefaultIconSet), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, DefaultIconSet, "foo.svg"), []byte("<svg/>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenEntityFromConfigE(GenEntityConfig{
+		IconRoot:    root,
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		OutDir:      outDir,
+		Name:        "Foo",
+		Icon:        "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"foo.svg", "foo.xml"} {
+		if _, err = os.Stat(filepath.Join(outDir, "Icons", "test", name)); err != nil {
+			t.Fatal("expected icon file", name, err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(outDir, "Icons", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatal("expected 2 icon files, got", len(files))
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Entities", "test.Foo.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ent MaltegoEntity
+	if err = xml.Unmarshal(data, &ent); err != nil {
+		t.Fatal(err)
+	}
+
+	if ent.SmallIconResource != "test/foo" || ent.LargeIconResource != "test/foo" {
+		t.Fatal("unexpected icon resources", ent.SmallIconResource, ent.LargeIconResource)
+	}
+}
+
+func TestGenEntityFS(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	src := fstest.MapFS{
+		"icons/router_red.xml":   {Data: []byte(icon)},
+		"icons/router_red16.svg": {Data: []byte("<svg/>")},
+		"icons/router_red24.svg": {Data: []byte("<svg/>")},
+		"icons/router_red32.svg": {Data: []byte("<svg/>")},
+		"icons/router_red48.svg": {Data: []byte("<svg/>")},
+		"icons/router_red96.svg": {Data: []byte("<svg/>")},
+	}
+
+	err := GenEntityFSE(src, GenEntityConfig{
+		IconSet:     "icons",
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		OutDir:      outDir,
+		Name:        "Interface",
+		Icon:        "router",
+		Color:       "red",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"router_red.xml", "router_red.svg", "router_red24.svg", "router_red32.svg", "router_red48.svg", "router_red96.svg"} {
+		if _, err = os.Stat(filepath.Join(outDir, "Icons", "test", name)); err != nil {
+			t.Fatal("expected icon file", name, err)
+		}
+	}
+}
+
+func TestGenEntityFromCoreInfo(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenEntityFromCoreInfoE(ArchiveConfig{
+		Dir:         dir,
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+	}, EntityCoreInfo{
+		Name:        "PCAP",
+		Description: "A packet capture dump file",
+		Parent:      "maltego.File",
+		Fields:      []*PropertyField{NewRequiredStringField("path", "Absolute path to the PCAP file")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "Entities", "test.PCAP.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGeneratedXML(data, `<MaltegoEntity id="test.PCAP" displayName="PCAP" displayNamePlural="PCAP" description="A packet capture dump file" category="Test" smallIconResource="" largeIconResource="" allowedRoot="true" conversionOrder="2147483647" visible="true">
+ <BaseEntities>
+  <BaseEntity>maltego.File</BaseEntity>
+ </BaseEntities>
+ <Properties value="properties.pcap" displayValue="properties.pcap">
+  <Groups></Groups>
+  <Fields>
+   <Field name="properties.pcap" type="string" nullable="true" hidden="false" readonly="false" description="" displayName="PCAP">
+    <SampleValue>-</SampleValue>
+   </Field>
+   <Field name="path" type="string" nullable="false" hidden="false" readonly="false" description="Absolute path to the PCAP file" displayName="Path">
+    <SampleValue></SampleValue>
+   </Field>
+  </Fields>
+ </Properties>
+</MaltegoEntity>`, t)
+}
+
+func TestGenEntitiesArchive(t *testing.T) {
+	var (
+		tmp     = t.TempDir()
+		archive = filepath.Join(tmp, "test"+configFileExtension)
+		icons   = fstest.MapFS{
+			"icons/router.xml": {Data: []byte(icon)},
+		}
+	)
+
+	for _, info := range maltegoEntities {
+		for _, size := range iconSizes {
+			icons["icons/"+info.Icon+size+".png"] = &fstest.MapFile{Data: []byte(info.Icon)}
+		}
+	}
+
+	err := GenEntitiesArchive(ArchiveConfig{
+		Dir:         filepath.Join(tmp, "entities"),
+		Archive:     archive,
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		Icons:       icons,
+		IconSet:     "icons",
+	}, maltegoEntities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := LoadConfigArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Entities) != len(maltegoEntities) {
+		t.Fatal("unexpected number of entities", len(a.Entities))
+	}
+
+	for i, e := range a.Entities {
+		info := maltegoEntities[i]
+		if e.ID != "test."+info.Name || e.Category != "Test" || e.Description != info.Description {
+			t.Fatal("unexpected entity", e.ID, e.Category, e.Description)
+		}
+		if e.SmallIconResource != "test/"+info.Icon {
+			t.Fatal("unexpected icon", e.SmallIconResource)
+		}
+		if len(e.Properties.Fields.Items) != len(info.Fields)+1 {
+			t.Fatal("unexpected number of fields for", e.ID, len(e.Properties.Fields.Items))
+		}
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	files := make(map[string]bool)
+	for _, f := range r.File {
+		files[f.Name] = true
+	}
+
+	for _, name := range []string{"version.properties", "EntityCategories/Test.category", "Entities/test.Email.entity", "Icons/test/router.xml", "Icons/test/router.png", "Icons/test/router96.png", "Icons/test/mail_outline.xml"} {
+		if !files[name] {
+			t.Fatal("missing archive entry", name)
+		}
+	}
+}
+
+// packTestArchive packs the directory at dir into a temporary archive and returns the zip entry names.
+func packTestArchive(t *testing.T, dir string) []string {
+	dst := filepath.Join(t.TempDir(), "test"+configFileExtension)
+
+	if err := packArchive(dir, dst, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+func TestPackArchiveEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, d := range []string{"Icons/test", "TransformSets", "Entities"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Entities", "test.Entity.entity"), []byte("<MaltegoEntity/>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	names := packTestArchive(t, dir)
+
+	for _, expected := range []string{"Icons/", "Icons/test/", "TransformSets/", "Entities/", "Entities/test.Entity.entity"} {
+		var found bool
+		for _, n := range names {
+			if n == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatal("missing archive entry", expected, "in", names)
+		}
+	}
+}
+
+func TestPackArchiveSeparators(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "TransformRepositories", "Local"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "TransformRepositories", "Local", "test.ToTest.transform"), []byte("<MaltegoTransform/>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	// base path inside the archive joined with the OS specific separator
+	if err := addFiles(w, dir, filepath.Join("base", "dir"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "\\") {
+			t.Fatal("unexpected backslash in archive entry", f.Name)
+		}
+	}
+
+	if len(r.File) != 3 || r.File[2].Name != "base/dir/TransformRepositories/Local/test.ToTest.transform" {
+		t.Fatal("unexpected archive entries", r.File)
+	}
+}
+
+func TestPackArchiveReproducible(t *testing.T) {
+	chdirTemp(t)
+
+	opts := ArchiveOptions{
+		ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	pack := func() []byte {
+		if err := GenMaltegoArchiveWithOptions("test", "Test", opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := GenTransformE("/", "Org", "Author", "test.", "test", "ToTest", "A test transform", "test.Entity", "test", nil, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := PackMaltegoArchiveWithOptions("test", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile("test" + configFileExtension)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	first := pack()
+	time.Sleep(time.Second)
+	second := pack()
+
+	if !bytes.Equal(first, second) {
+		t.Fatal("archives packed with a fixed time differ")
+	}
+}
+
+func TestPackArchiveDefaultTime(t *testing.T) {
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+		defer os.Setenv("SOURCE_DATE_EPOCH", epoch)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "version.properties"), []byte("test"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "test"+configFileExtension)
+
+	start := time.Now().Add(-2 * time.Second)
+	if err := packArchive(dir, dst, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// zip timestamps have a resolution of two seconds
+	if len(r.File) != 1 || r.File[0].Modified.Before(start) || r.File[0].Modified.After(time.Now().Add(2*time.Second)) {
+		t.Fatal("archive entry not stamped with the current time", r.File)
+	}
+}
+
+func TestPackArchiveInvalidSourceDateEpoch(t *testing.T) {
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		defer os.Setenv("SOURCE_DATE_EPOCH", epoch)
+	} else {
+		defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	}
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "version.properties"), []byte("test"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := packArchive(dir, filepath.Join(t.TempDir(), "test"+configFileExtension), ArchiveOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid SOURCE_DATE_EPOCH") {
+		t.Fatal("expected invalid SOURCE_DATE_EPOCH error, got", err)
+	}
+}
+
+func TestPackArchiveOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	// create files in non sorted order
+	for _, name := range []string{"version.properties", "Servers/Local.tas", "Entities/test.B.entity", "Entities/test.A.entity"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := packTestArchive(t, dir)
+	if !sort.StringsAreSorted(names) {
+		t.Fatal("archive entries are not sorted:", names)
+	}
+}
+
+func TestAddFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"b.txt", "a/z.txt", "a/b/c.txt", "A.txt"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	wr := zip.NewWriter(&buf)
+	if err := addFiles(wr, dir, "root", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		names    []string
+		expected = []string{"root/A.txt", "root/a/", "root/a/b/", "root/a/b/c.txt", "root/a/z.txt", "root/b.txt"}
+	)
+	for _, f := range r.File {
+		names = append(names, f.Name)
+
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		rc, errOpen := f.Open()
+		if errOpen != nil {
+			t.Fatal(errOpen)
+		}
+		data, errRead := io.ReadAll(rc)
+		rc.Close()
+		if errRead != nil {
+			t.Fatal(errRead)
+		}
+		if string(data) != strings.TrimPrefix(f.Name, "root/") {
+			t.Fatal("unexpected content for", f.Name, string(data))
+		}
+	}
+
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatal("unexpected archive entries", names)
+	}
+}
+
+func TestZipDir(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"Icons/Category/icon.png", "Entities/b.entity", "Entities/a.entity", "version.properties"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ZipDir(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		names    []string
+		expected = []string{"Entities/", "Entities/a.entity", "Entities/b.entity", "Icons/", "Icons/Category/", "Icons/Category/icon.png", "version.properties"}
+	)
+	for _, f := range r.File {
+		names = append(names, f.Name)
+
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		data, errRead := readZipFile(f)
+		if errRead != nil {
+			t.Fatal(errRead)
+		}
+		if string(data) != f.Name {
+			t.Fatal("unexpected content for", f.Name, string(data))
+		}
+	}
+
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatal("unexpected archive entries", names)
+	}
+
+	// zipping the same directory again later must produce the same archive
+	time.Sleep(time.Second)
+
+	var again bytes.Buffer
+	if err = ZipDir(&again, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Fatal("archive is not deterministic")
+	}
+
+	if err = ZipDir(io.Discard, filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error for missing directory")
+	}
+}
+
+func TestGenServerListingSeeds(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Servers"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultServerConfig()
+	cfg.Seeds = []Seed{{Name: "Example", URL: "https://transforms.example.com/seed"}}
+
+	if err := GenServerListingWithConfig(cfg, "test.", outDir, []*TransformCoreInfo{{ID: "ToTest"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Servers", "Local.tas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `
+ <Seeds>
+  <Seed name="Example" url="https://transforms.example.com/seed"></Seed>
+ </Seeds>`) {
+		t.Fatal("unexpected seeds", string(data))
+	}
+
+	var srv Server
+	if err = xml.Unmarshal(data, &srv); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Seeds.Items) != 1 || srv.Seeds.Items[0] != cfg.Seeds[0] {
+		t.Fatal("unexpected parsed seeds", srv.Seeds.Items)
+	}
+}
+
+func TestDuplicateTransforms(t *testing.T) {
+	outDir := t.TempDir()
+
+	for _, dir := range []string{"Servers", "TransformSets"} {
+		if err := os.MkdirAll(filepath.Join(outDir, dir), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trs := []*TransformCoreInfo{{ID: "ToTest"}, {ID: "ToOther"}, {ID: "ToTest"}}
+
+	err := GenServerListingE("test.", outDir, trs)
+	if !errors.Is(err, ErrDuplicateTransform) || !strings.Contains(err.Error(), "ToTest") {
+		t.Fatal("expected duplicate transform error for server listing, got", err)
+	}
+
+	err = GenTransformSetE("Test", "A test set", "test.", outDir, trs)
+	if !errors.Is(err, ErrDuplicateTransform) || !strings.Contains(err.Error(), "ToTest") {
+		t.Fatal("expected duplicate transform error for transform set, got", err)
+	}
+
+	for _, file := range []string{filepath.Join("Servers", "Local.tas"), filepath.Join("TransformSets", "Test.set")} {
+		if _, err = os.Stat(filepath.Join(outDir, file)); !os.IsNotExist(err) {
+			t.Fatal("unexpected file", file, err)
+		}
+	}
+
+	if err = GenTransformSetE("Test", "A test set", "test.", outDir, trs[:2]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenServerListingWithConfig(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Servers"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenServerListingWithConfig(ServerConfig{
+		Name:            "Remote",
+		Description:     "Remote transform server",
+		URL:             "https://transforms.example.com",
+		ProtocolVersion: "2.0",
+		AuthType:        "MaltegoPublicKeyAuthenticator",
+		Enabled:         true,
+	}, "test.", outDir, []*TransformCoreInfo{{ID: "ToTest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Servers", "Remote.tas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var srv Server
+	if err = xml.Unmarshal(data, &srv); err != nil {
+		t.Fatal(err)
+	}
+
+	if srv.Name != "Remote" || !srv.Enabled || srv.URL != "https://transforms.example.com" {
+		t.Fatal("unexpected server attributes", srv.Name, srv.Enabled, srv.URL)
+	}
+	if srv.Protocol.Version != "2.0" || srv.Authentication.Type != "MaltegoPublicKeyAuthenticator" {
+		t.Fatal("unexpected protocol or authentication", srv.Protocol.Version, srv.Authentication.Type)
+	}
+	if len(srv.Transforms.Transform) != 1 || srv.Transforms.Transform[0].Name != "test.ToTest" {
+		t.Fatal("unexpected transforms", srv.Transforms.Transform)
+	}
+}
+
+func TestNewServerTransform(t *testing.T) {
+	expected, err := os.ReadFile(filepath.Join("testdata", "server.transform"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewServerTransform("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName", "https://transforms.example.com/", NewAuthProperty("org.apikey", "API Key"))
+
+	data, err := xml.MarshalIndent(tr, "", "   ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := xmlTokens(t, data), xmlTokens(t, expected); !reflect.DeepEqual(got, want) {
+		t.Fatalf("server transform differs from the exported file:\n%s\n\nexpected:\n%s", data, expected)
+	}
+}
+
+// xmlTokens returns the elements, attributes and non whitespace character data of the XML document in data,
+// so that documents can be compared independent of indentation and self-closing tags.
+func xmlTokens(t *testing.T, data []byte) []string {
+	var (
+		tokens []string
+		dec    = xml.NewDecoder(bytes.NewReader(data))
+	)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return tokens
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			tokens = append(tokens, "<"+tok.Name.Local)
+			for _, a := range tok.Attr {
+				tokens = append(tokens, a.Name.Local+"="+strconv.Quote(a.Value))
+			}
+		case xml.EndElement:
+			tokens = append(tokens, "</"+tok.Name.Local)
+		case xml.CharData:
+			if text := strings.TrimSpace(string(tok)); text != "" {
+				tokens = append(tokens, text)
+			}
+		}
+	}
+}
+
+func TestValidateTransformXML(t *testing.T) {
+	marshal := func(tr MaltegoTransform) []byte {
+		data, err := xml.MarshalIndent(tr, "", " ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	valid := NewTransform("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName")
+
+	for _, data := range [][]byte{
+		marshal(valid),
+		marshal(NewServerTransform("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName", "https://transforms.example.com")),
+	} {
+		if err := ValidateTransformXML(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		expected string
+		modify   func(tr *MaltegoTransform)
+	}{
+		{"missing name", func(tr *MaltegoTransform) { tr.Name = "" }},
+		{`invalid visibility "everyone"`, func(tr *MaltegoTransform) { tr.Visibility = "everyone" }},
+		{"missing transform adapter", func(tr *MaltegoTransform) { tr.TransformAdapter = "" }},
+		{"missing input entity type", func(tr *MaltegoTransform) { tr.Constraints.Entity.Type = "" }},
+		{"missing property transform.local.command", func(tr *MaltegoTransform) {
+			tr.Properties.Fields.Property = tr.Properties.Fields.Property[1:]
+		}},
+	} {
+		tr := valid
+		tc.modify(&tr)
+
+		err := ValidateTransformXML(marshal(tr))
+		if !errors.Is(err, ErrInvalidTransform) || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatal("expected error", tc.expected, "got", err)
+		}
+	}
+
+	if err := ValidateTransformXML([]byte("<MaltegoEntity/>")); !errors.Is(err, ErrInvalidTransform) {
+		t.Fatal("expected error for other document, got", err)
+	}
+}
+
+func TestNewTransformSettingsWorkingDirectory(t *testing.T) {
+	workingDir := func(trs TransformSettings) string {
+		for _, p := range trs.Property.Items {
+			if p.Name == "transform.local.working-directory" {
+				return p.Text
+			}
+		}
+		return ""
+	}
+
+	trs := NewTransformSettings(`C:\transforms`, []string{"toTest"}, false, "test.exe")
+	if dir := workingDir(trs); dir != `C:\transforms` {
+		t.Fatal("unexpected working directory", dir)
+	}
+
+	trs = NewTransformSettings("", []string{"toTest"}, false, "test")
+	if dir := workingDir(trs); dir != DefaultWorkingDirectory {
+		t.Fatal("expected default working directory, got", dir)
+	}
+}
+
+func TestGenTransformDebug(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		outDir := t.TempDir()
+
+		if err := os.MkdirAll(filepath.Join(outDir, "TransformRepositories", "Local"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := GenTransformE("/", "Org", "Author", "test.", outDir, "ToTest", "A test transform", "test.Entity", "test", nil, debug); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(outDir, "TransformRepositories", "Local", "test.ToTest.transformsettings"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var trs TransformSettings
+		if err = xml.Unmarshal(data, &trs); err != nil {
+			t.Fatal(err)
+		}
+
+		var value string
+		for _, p := range trs.Property.Items {
+			if p.Name == "transform.local.debug" {
+				value = p.Text
+			}
+		}
+		if value != strconv.FormatBool(debug) {
+			t.Fatal("unexpected debug property", value, "expected", debug)
+		}
+	}
+}
+
+func TestNewTransformSettingsForOS(t *testing.T) {
+	props := func(trs TransformSettings) map[string]string {
+		m := make(map[string]string)
+		for _, p := range trs.Property.Items {
+			m[p.Name] = p.Text
+		}
+		return m
+	}
+
+	for _, tc := range []struct {
+		goos, workingDir, executable string
+		expDir, expExecutable        string
+	}{
+		{"linux", "", "/usr/local/bin/net", DefaultWorkingDirectory, "/usr/local/bin/net"},
+		{"linux", "/opt/net", "net", "/opt/net", "net"},
+		{"windows", "", "net", DefaultWindowsWorkingDirectory, "net.exe"},
+		{"windows", "C:/Tools/net", "C:/Tools/net/bin/net", `C:\Tools\net`, `C:\Tools\net\bin\net.exe`},
+		{"windows", `D:\net`, `D:\net\net.exe`, `D:\net`, `D:\net\net.exe`},
+		{"windows", "", "transform.py", DefaultWindowsWorkingDirectory, "transform.py"},
+	} {
+		p := props(NewTransformSettingsForOS(tc.goos, tc.workingDir, []string{"toTest"}, false, tc.executable))
+
+		if dir := p["transform.local.working-directory"]; dir != tc.expDir {
+			t.Fatal("unexpected working directory for", tc.goos, dir)
+		}
+		if cmd := p["transform.local.command"]; cmd != tc.expExecutable {
+			t.Fatal("unexpected command for", tc.goos, cmd)
+		}
+	}
+
+	// the generated settings target the OS from the transform options
+	outDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(outDir, "TransformRepositories", "Local"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, goos := range []string{"linux", "windows"} {
+		opts := DefaultTransformOptions("Org")
+		opts.GOOS = goos
+
+		if err := GenTransformWithOptions("", "Org", "Author", goos+".", outDir, "ToTest", "A test transform", "test.Entity", "net", nil, false, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for goos, expected := range map[string]string{"linux": "net", "windows": "net.exe"} {
+		data, err := os.ReadFile(filepath.Join(outDir, "TransformRepositories", "Local", goos+".ToTest.transformsettings"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var trs TransformSettings
+		if err = xml.Unmarshal(data, &trs); err != nil {
+			t.Fatal(err)
+		}
+		if cmd := props(trs)["transform.local.command"]; cmd != expected {
+			t.Fatal("unexpected command for", goos, cmd)
+		}
+	}
+}
+
+func TestNewTransformSettingsFromTemplate(t *testing.T) {
+	trs, err := NewTransformSettingsFromTemplate("", "run --name {{.ID}} --json", "ToAuditRecords", false, "/usr/local/bin/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var params string
+	for _, p := range trs.Property.Items {
+		if p.Name == "transform.local.parameters" {
+			params = p.Text
+		}
+	}
+	if params != "run --name ToAuditRecords --json" {
+		t.Fatal("unexpected parameters", params)
+	}
+
+	for _, tmpl := range []string{"run {{.ID", "run {{.Name}}"} {
+		if _, err = NewTransformSettingsFromTemplate("", tmpl, "ToAuditRecords", false, "net"); err == nil {
+			t.Fatal("expected error for template", tmpl)
+		}
+	}
+}
+
+func TestNewTransformWithOptions(t *testing.T) {
+	opts := DefaultTransformOptions("Org")
+	opts.DefaultSets = []string{"OSINT"}
+	opts.StealthLevel = 1
+
+	data, err := xml.Marshal(NewTransformWithOptions("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName", opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `<defaultSets><Set name="OSINT"></Set></defaultSets><StealthLevel>1</StealthLevel>`) {
+		t.Fatal("unexpected transform sets or stealth level:", string(data))
+	}
+}
+
+func TestNewTransformProperties(t *testing.T) {
+	tr := NewTransform("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName", Property{
+		Name:        "org.apikey",
+		Type:        "string",
+		Nullable:    false,
+		Description: "API key for the lookup service",
+		Visibility:  "public",
+		Auth:        true,
+		DisplayName: "API Key",
+	})
+
+	data, err := xml.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `<Property name="transform.local.debug" type="boolean" nullable="true" hidden="false" readonly="false" description="When this is set, the transform&amp;apos;s text output will be printed to the output window" popup="false" abstract="false" visibility="public" auth="false" displayName="Show debug info"><SampleValue>false</SampleValue></Property><Property name="org.apikey" type="string" nullable="false" hidden="false" readonly="false" description="API key for the lookup service" popup="false" abstract="false" visibility="public" auth="true" displayName="API Key"><SampleValue></SampleValue></Property></Fields>`) {
+		t.Fatal("missing additional property", string(data))
+	}
+	if !strings.Contains(string(data), `requireDisplayInfo="false"`) {
+		t.Fatal("unexpected requireDisplayInfo", string(data))
+	}
+
+	opts := DefaultTransformOptions("Org")
+	opts.RequireDisplayInfo = true
+
+	if tr = NewTransformWithOptions("Org", "Author", "org.", "ToIPAddress", "Resolve a DNS name", "maltego.DNSName", opts); !tr.RequireDisplayInfo {
+		t.Fatal("RequireDisplayInfo not set")
+	}
+}
+
+func TestNewAuthProperty(t *testing.T) {
+	data, err := xml.Marshal(NewAuthProperty("org.apikey", "API Key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<Property name="org.apikey" type="string" nullable="false" hidden="true" readonly="false" description="" popup="true" abstract="false" visibility="public" auth="true" displayName="API Key"><SampleValue></SampleValue></Property>`
+	if string(data) != expected {
+		t.Fatal("unexpected property", string(data))
+	}
+}
+
+func TestNewTransformInputConstraints(t *testing.T) {
+	opts := DefaultTransformOptions("Org")
+	opts.InputMin = 1
+	opts.InputMax = 0
+
+	data, err := xml.Marshal(NewTransformWithOptions("Org", "Author", "org.", "ToSummary", "Summarize the selection", "maltego.DNSName", opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `<InputConstraints><Entity type="maltego.DNSName" min="1" max="0"></Entity></InputConstraints>`) {
+		t.Fatal("unexpected input constraints:", string(data))
+	}
+}
+
+func TestGenMachinesFrom(t *testing.T) {
+	var (
+		srcDir = t.TempDir()
+		ident  = t.TempDir()
+	)
+
+	for _, name := range []string{"Footprint.machine", "Monitor.machine"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("machine(\"test."+name+"\") {\n\tstart {\n\t\trun(\"test.ToTest\")\n\t}\n}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := GenMachinesFrom(srcDir, ident, "test.", func(name string) MachineProperties {
+		return MachineProperties{
+			Favorite: name == "Footprint.machine",
+			Enabled:  true,
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"test.Footprint.properties": "favorite=true\nenabled=true",
+		"test.Monitor.properties":   "favorite=false\nenabled=true",
+	} {
+		data, errRead := os.ReadFile(filepath.Join(ident, "Machines", name))
+		if errRead != nil {
+			t.Fatal(errRead)
+		}
+		if !strings.HasSuffix(string(data), expected) {
+			t.Fatal("unexpected properties for", name, string(data))
+		}
+	}
+
+	for _, name := range []string{"test.Footprint.machine", "test.Monitor.machine"} {
+		if _, err = os.Stat(filepath.Join(ident, "Machines", name)); err != nil {
+			t.Fatal("expected machine file", name, err)
+		}
+	}
+}
+
+func TestGenMachinesFromWithOptions(t *testing.T) {
+	var (
+		srcDir = t.TempDir()
+		ident  = t.TempDir()
+		opts   = ArchiveOptions{ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "Footprint.machine"), []byte("machine(\"test.Footprint\") {\n\tstart {\n\t\trun(\"test.ToTest\")\n\t}\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenMachinesFromWithOptions(srcDir, ident, "test.", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(ident, "Machines", "test.Footprint.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "#Fri Jan  1 00:00:00 UTC 2021\n") {
+		t.Fatal("properties not stamped with the archive time", string(data))
+	}
+}
+
+func TestMachinePropertiesDisabled(t *testing.T) {
+	var (
+		srcDir = t.TempDir()
+		ident  = t.TempDir()
+	)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "Footprint.machine"), []byte("machine(\"test.Footprint\") {\n\tstart {\n\t\trun(\"test.ToTest\")\n\t}\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenMachinesFrom(srcDir, ident, "test.", func(name string) MachineProperties {
+		return MachineProperties{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(ident, "Machines", "test.Footprint.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitN(string(data), "\n", 2)
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "#") || lines[1] != "favorite=false\nenabled=false" {
+		t.Fatal("unexpected properties", string(data))
+	}
+}
+
+func TestMachinePropertiesMarshal(t *testing.T) {
+	p := MachineProperties{
+		Favorite: true,
+		Extra: map[string]string{
+			"timer":      "10",
+			"descr:note": "a=b\nc",
+		},
+	}
+
+	ts := time.Date(2020, 6, 13, 21, 48, 54, 0, time.UTC)
+	if out := string(p.Marshal(ts)); out != "#Sat Jun 13 21:48:54 UTC 2020\nfavorite=true\nenabled=false\ndescr\\:note=a\\=b\\nc\ntimer=10" {
+		t.Fatal("unexpected properties", out)
+	}
+}
+
+func TestGenMachinesFromSkipsOtherFiles(t *testing.T) {
+	var (
+		srcDir = t.TempDir()
+		ident  = t.TempDir()
+	)
+
+	if err := os.Mkdir(filepath.Join(srcDir, "drafts"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"README.md", ".DS_Store"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("not a machine"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "Footprint.machine"), []byte("machine(\"test.Footprint\") {\n\tstart {\n\t\trun(\"test.ToTest\")\n\t}\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenMachinesFrom(srcDir, ident, "test.", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(filepath.Join(ident, "Machines"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	if strings.Join(names, ",") != "test.Footprint.machine,test.Footprint.properties" {
+		t.Fatal("unexpected machine files", names)
+	}
+}
+
+func TestGenEntityDisplayValueField(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenEntityFromConfigE(GenEntityConfig{
+		Category:          "Test",
+		Ident:             "test",
+		Prefix:            "test.",
+		PropsPrefix:       "properties.",
+		OutDir:            outDir,
+		Name:              "Host",
+		Fields:            []*PropertyField{NewStringField("properties.label", "Human readable label")},
+		DisplayValueField: "properties.label",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Entities", "test.Host.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `<Properties value="properties.host" displayValue="properties.label">`) {
+		t.Fatal("unexpected value and display value:", string(data))
+	}
+}
+
+func TestGenEntityBaseEntities(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := GenEntityFromConfigE(GenEntityConfig{
+		Category:    "Test",
+		Ident:       "test",
+		Prefix:      "test.",
+		PropsPrefix: "properties.",
+		OutDir:      outDir,
+		Name:        "Host",
+		Parent:      "maltego.DNSName",
+		Parents:     []string{"maltego.Domain"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Entities", "test.Host.entity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "<BaseEntities>\n  <BaseEntity>maltego.DNSName</BaseEntity>\n  <BaseEntity>maltego.Domain</BaseEntity>\n </BaseEntities>") {
+		t.Fatal("unexpected base entities:", string(data))
+	}
+}
+
+func TestEntityCategoryCasing(t *testing.T) {
+	chdirTemp(t)
+
+	if err := GenEntityArchiveE("MyCategory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenMaltegoArchiveE("test", "MyCategory"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{
+		filepath.Join("entities", "EntityCategories", "MyCategory.category"),
+		filepath.Join("test", "EntityCategories", "test.category"),
+	} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `<EntityCategory name="MyCategory"/>` {
+			t.Fatal("unexpected category in", file, string(data))
+		}
+	}
+}
+
+func TestGenMaltegoArchiveCategories(t *testing.T) {
+	chdirTemp(t)
+
+	err := GenMaltegoArchiveCategories("test", []string{"Network", "R&D <Lab>", `Threat "Intel"`}, ArchiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(filepath.Join("test", "EntityCategories"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatal("unexpected number of category files", len(files))
+	}
+
+	for file, expected := range map[string]string{
+		"Network.category":        `<EntityCategory name="Network"/>`,
+		"R&D _Lab_.category":      `<EntityCategory name="R&amp;D &lt;Lab&gt;"/>`,
+		"Threat _Intel_.category": `<EntityCategory name="Threat &#34;Intel&#34;"/>`,
+	} {
+		data, errRead := os.ReadFile(filepath.Join("test", "EntityCategories", file))
+		if errRead != nil {
+			t.Fatal(errRead)
+		}
+		if string(data) != expected {
+			t.Fatal("unexpected category in", file, string(data))
+		}
+
+		var c struct {
+			Name string `xml:"name,attr"`
+		}
+		if errRead = xml.Unmarshal(data, &c); errRead != nil {
+			t.Fatal("invalid category XML in", file, errRead)
+		}
+	}
+
+	err = GenMaltegoArchiveCategories("test", []string{"A/B", "A:B"}, ArchiveOptions{})
+	if !errors.Is(err, ErrArchiveCollision) {
+		t.Fatal("expected collision error, got", err)
+	}
+}
+
+func TestEntityCategoryEscaping(t *testing.T) {
+	chdirTemp(t)
+
+	const category = `Research & "Development"`
+
+	if err := GenEntityArchiveE(category); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenMaltegoArchiveE("test", category); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{
+		filepath.Join("entities", "EntityCategories", `Research & _Development_.category`),
+		filepath.Join("test", "EntityCategories", "test.category"),
+	} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `<EntityCategory name="Research &amp; &#34;Development&#34;"/>` {
+			t.Fatal("unexpected category in", file, string(data))
+		}
+
+		var c struct {
+			Name string `xml:"name,attr"`
+		}
+		if err = xml.Unmarshal(data, &c); err != nil {
+			t.Fatal("invalid category XML in", file, err)
+		}
+		if c.Name != category {
+			t.Fatal("unexpected category name", c.Name)
+		}
+	}
+}
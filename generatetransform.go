@@ -14,21 +14,23 @@
 package maltego
 
 import (
-	"archive/zip"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/template"
 	"unicode"
 )
 
 const (
 	configFileExtension = ".mtz"
+
+	localTransformAdapter  = "com.paterva.maltego.transform.protocol.v2api.LocalTransformAdapterV2"
+	remoteTransformAdapter = "com.paterva.maltego.transform.protocol.v2api.RemoteTransformAdapterV2"
 )
 
 // Transforms
@@ -90,6 +92,23 @@ type Property struct {
 	SampleValue  string `xml:"SampleValue"`
 }
 
+// NewAuthProperty creates a string transform setting for a secret, such as an API key.
+// The analyst is prompted for the value in a popup, and as an auth property the value is hidden and not shown in plain text.
+func NewAuthProperty(name, displayName string) Property {
+	return Property{
+		Name:        name,
+		Type:        "string",
+		Nullable:    false,
+		Hidden:      true,
+		Readonly:    false,
+		Popup:       true,
+		Abstract:    false,
+		Visibility:  "public",
+		Auth:        true,
+		DisplayName: displayName,
+	}
+}
+
 // InputConstraints structure
 type InputConstraints struct {
 	XMLName xml.Name `xml:"InputConstraints"`
@@ -129,7 +148,7 @@ type TransformSettingProperty struct {
 }
 
 type TransformSettingProperties struct {
-	Items []TransformSettingProperty `xml:"Properties"`
+	Items []TransformSettingProperty `xml:"Property"`
 }
 
 // TransformSettings structure
@@ -167,7 +186,20 @@ type Server struct {
 			Name string `xml:"name,attr"`
 		} `xml:"Transform"`
 	} `xml:"Transforms"`
-	Seeds string `xml:"Seeds"`
+	Seeds Seeds `xml:"Seeds"`
+}
+
+// Seeds contains the transform seeds of a server listing.
+type Seeds struct {
+	Text  string `xml:",chardata"`
+	Items []Seed `xml:"Seed"`
+}
+
+// Seed references a transform seed, from which maltego discovers the transforms of a server.
+type Seed struct {
+	Text string `xml:",chardata"`
+	Name string `xml:"name,attr"`
+	URL  string `xml:"url,attr"`
 }
 
 type TransformSet struct {
@@ -218,7 +250,41 @@ func ToTransformDisplayName(in, org string) string {
 	return strings.TrimSpace(b.String() + " [" + org + "]")
 }
 
+// DefaultWorkingDirectory is used for local transforms if no working directory has been provided.
+var DefaultWorkingDirectory = "/usr/local/"
+
+// DefaultWindowsWorkingDirectory is used for local transforms targeting windows if no working directory has been provided.
+var DefaultWindowsWorkingDirectory = `C:\Program Files\`
+
+// NewTransformSettings creates the settings for a local transform, that invokes executable with args in workingDir.
+// If workingDir is empty, DefaultWorkingDirectory will be used.
+// The settings are generated for a maltego client on linux, use NewTransformSettingsForOS to target other systems.
 func NewTransformSettings(workingDir string, args []string, debug bool, executable string) TransformSettings {
+	return NewTransformSettingsForOS("linux", workingDir, args, debug, executable)
+}
+
+// NewTransformSettingsForOS creates the settings for a local transform like NewTransformSettings,
+// for a maltego client running on goos.
+// For windows, forward slashes in the executable and workingDir are replaced with backslashes,
+// the .exe extension is added to an executable without extension
+// and DefaultWindowsWorkingDirectory is used if workingDir is empty.
+func NewTransformSettingsForOS(goos, workingDir string, args []string, debug bool, executable string) TransformSettings {
+	if goos == "windows" {
+		if workingDir == "" {
+			workingDir = DefaultWindowsWorkingDirectory
+		}
+		workingDir = strings.ReplaceAll(workingDir, "/", `\`)
+		executable = strings.ReplaceAll(executable, "/", `\`)
+
+		if name := executable[strings.LastIndex(executable, `\`)+1:]; name != "" && !strings.Contains(name, ".") {
+			executable += ".exe"
+		}
+	}
+
+	if workingDir == "" {
+		workingDir = DefaultWorkingDirectory
+	}
+
 	trs := TransformSettings{
 		Enabled:            true,
 		DisclaimerAccepted: false,
@@ -258,7 +324,94 @@ func NewTransformSettings(workingDir string, args []string, debug bool, executab
 	return trs
 }
 
-func NewTransform(org, author, prefix, id string, description string, input string) MaltegoTransform {
+// TransformParameters is the data available in templates for the parameters of a local transform.
+type TransformParameters struct {
+
+	// ID of the transform, e.g. ToAuditRecords.
+	ID string
+}
+
+// RenderTransformParameters renders the parameters for the local transform with the given id
+// from the text/template tmpl, e.g. "run --name {{.ID}}", see TransformParameters for the available fields.
+func RenderTransformParameters(tmpl, id string) (string, error) {
+	t, err := template.New("parameters").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid parameter template: %w", err)
+	}
+
+	var b strings.Builder
+
+	err = t.Execute(&b, TransformParameters{ID: id})
+	if err != nil {
+		return "", fmt.Errorf("failed to render parameters for transform %s: %w", id, err)
+	}
+
+	return b.String(), nil
+}
+
+// NewTransformSettingsFromTemplate creates the settings for a local transform like NewTransformSettings,
+// but renders the parameters for the transform with the given id from the text/template tmpl.
+// To target other systems, pass the parameters from RenderTransformParameters to NewTransformSettingsForOS.
+func NewTransformSettingsFromTemplate(workingDir, tmpl, id string, debug bool, executable string) (TransformSettings, error) {
+	params, err := RenderTransformParameters(tmpl, id)
+	if err != nil {
+		return TransformSettings{}, err
+	}
+
+	return NewTransformSettings(workingDir, []string{params}, debug, executable), nil
+}
+
+// TransformOptions configure optional attributes of a transform.
+type TransformOptions struct {
+
+	// DefaultSets are the names of the transform sets the transform is added to.
+	DefaultSets []string
+
+	// StealthLevel of the transform.
+	StealthLevel int
+
+	// InputMin and InputMax constrain the number of input entities, a maximum of 0 means unbounded.
+	InputMin int
+	InputMax int
+
+	// RequireDisplayInfo asks the analyst to review the transform settings before the first run.
+	RequireDisplayInfo bool
+
+	// Properties are additional transform settings, that are added after the properties for the local command,
+	// e.g. to prompt the analyst for an API key.
+	Properties []Property
+
+	// GOOS is the operating system of the maltego client, that the settings of local transforms are generated for.
+	// It uses the GOOS naming and defaults to linux, see NewTransformSettingsForOS.
+	GOOS string
+}
+
+// DefaultTransformOptions returns the default options for transforms of org.
+func DefaultTransformOptions(org string) TransformOptions {
+	return TransformOptions{
+		DefaultSets:  []string{org},
+		StealthLevel: 0,
+		InputMin:     1,
+		InputMax:     1,
+	}
+}
+
+// NewTransform creates a local transform using the DefaultTransformOptions.
+// The provided properties are added as additional transform settings.
+func NewTransform(org, author, prefix, id string, description string, input string, props ...Property) MaltegoTransform {
+	opts := DefaultTransformOptions(org)
+	opts.Properties = props
+
+	return NewTransformWithOptions(org, author, prefix, id, description, input, opts)
+}
+
+// NewTransformWithOptions creates a local transform configured by opts.
+func NewTransformWithOptions(org, author, prefix, id string, description string, input string, opts TransformOptions) MaltegoTransform {
+	var sets []Set
+	for _, name := range opts.DefaultSets {
+		sets = append(sets, Set{Name: name})
+	}
+
 	tr := MaltegoTransform{
 		Name:               prefix + id,
 		DisplayName:        ToTransformDisplayName(id, org),
@@ -267,8 +420,8 @@ func NewTransform(org, author, prefix, id string, description string, input stri
 		Visibility:         "public",
 		Description:        description,
 		Author:             author,
-		RequireDisplayInfo: false,
-		TransformAdapter:   "com.paterva.maltego.transform.protocol.v2api.LocalTransformAdapterV2",
+		RequireDisplayInfo: opts.RequireDisplayInfo,
+		TransformAdapter:   localTransformAdapter,
 		Properties: XMLTransformProperties{
 			Fields: struct {
 				Text     string     `xml:",chardata"`
@@ -364,73 +517,178 @@ func NewTransform(org, author, prefix, id string, description string, input stri
 			}{
 				Text: "",
 				Type: input,
-				Min:  1,
-				Max:  1,
+				Min:  opts.InputMin,
+				Max:  opts.InputMax,
 			},
 		},
 		OutputEntities: "",
-		DefaultSets: defaultSets{Items: []Set{
-			{
-				Name: org,
-			},
-		}},
-		StealthLevel: "0",
+		DefaultSets:    defaultSets{Items: sets},
+		StealthLevel:   strconv.Itoa(opts.StealthLevel),
 	}
 
+	tr.Properties.Fields.Property = append(tr.Properties.Fields.Property, opts.Properties...)
+
 	return tr
 }
 
-func GenTransform(workingDir, org, author, prefix string, outDir string, name string, description string, inputEntity string, executable string, args []string, debug bool) {
-	var (
-		tr  = NewTransform(org, author, prefix, name, description, inputEntity)
-		trs = NewTransformSettings(workingDir, args, debug, executable)
-	)
+// ServerURLProperty is the name of the transform setting that holds the URL a server transform is invoked at.
+const ServerURLProperty = "transform.server.url"
+
+// NewServerTransform creates a transform that is executed on a remote transform server (TDS).
+// Instead of the command properties of local transforms, it has a ServerURLProperty with the route of the transform
+// below baseURL, as registered by RegisterTransform. Authentication settings, e.g. created with NewAuthProperty,
+// are added as additional transform settings.
+func NewServerTransform(org, author, prefix, id string, description string, input string, baseURL string, auth ...Property) MaltegoTransform {
+	tr := NewTransform(org, author, prefix, id, description, input)
+	tr.TransformAdapter = remoteTransformAdapter
+
+	url := strings.TrimSuffix(baseURL, "/") + "/run/" + id
+	tr.Properties.Fields.Property = append([]Property{
+		{
+			Name:         ServerURLProperty,
+			Type:         "string",
+			Nullable:     false,
+			Hidden:       true,
+			Readonly:     true,
+			Description:  "The URL of the transform on the transform server",
+			Popup:        false,
+			Abstract:     false,
+			Visibility:   "public",
+			Auth:         false,
+			DisplayName:  "Transform URL",
+			DefaultValue: url,
+			SampleValue:  url,
+		},
+	}, auth...)
 
-	// write Transform
+	return tr
+}
 
-	data, err := xml.MarshalIndent(tr, "", " ")
+// ErrInvalidTransform indicates that a transform definition is missing attributes or elements required by maltego.
+var ErrInvalidTransform = errors.New("invalid transform")
+
+// ValidateTransformXML checks that data contains a marshaled MaltegoTransform with everything maltego requires:
+// a name, a public or private visibility, a transform adapter, an input entity
+// and for local transforms the property for the command to execute.
+// All problems that were found are reported in the returned error.
+func ValidateTransformXML(data []byte) error {
+	var tr MaltegoTransform
+
+	err := xml.Unmarshal(data, &tr)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("%w: %s", ErrInvalidTransform, err)
 	}
 
-	f, err := os.Create(filepath.Join(outDir, "TransformRepositories", "Local", prefix+name+".transform"))
-	if err != nil {
+	var problems []string
+
+	if strings.TrimSpace(tr.Name) == "" {
+		problems = append(problems, "missing name")
+	}
+
+	if tr.Visibility != "public" && tr.Visibility != "private" {
+		problems = append(problems, "invalid visibility "+strconv.Quote(tr.Visibility))
+	}
+
+	if strings.TrimSpace(tr.TransformAdapter) == "" {
+		problems = append(problems, "missing transform adapter")
+	}
+
+	if tr.Constraints.Entity.Type == "" {
+		problems = append(problems, "missing input entity type")
+	}
+
+	if tr.TransformAdapter == localTransformAdapter {
+		var command bool
+		for _, p := range tr.Properties.Fields.Property {
+			if p.Name == "transform.local.command" {
+				command = true
+			}
+		}
+		if !command {
+			problems = append(problems, "missing property transform.local.command")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w %q: %s", ErrInvalidTransform, tr.Name, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// GenServerTransform will generate a server transform hosted below baseURL in the given transform repository of outDir.
+func GenServerTransform(org, author, prefix, outDir, repository, name, description, inputEntity, baseURL string, auth ...Property) {
+	if err := GenServerTransformE(org, author, prefix, outDir, repository, name, description, inputEntity, baseURL, auth...); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// GenServerTransformE is the error returning variant of GenServerTransform.
+func GenServerTransformE(org, author, prefix, outDir, repository, name, description, inputEntity, baseURL string, auth ...Property) error {
+	tr := NewServerTransform(org, author, prefix, name, description, inputEntity, baseURL, auth...)
 
-	_, err = f.Write(data)
+	data, err := xml.MarshalIndent(tr, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal transform %s: %w", prefix+name, err)
 	}
 
-	err = f.Close()
+	err = os.MkdirAll(filepath.Join(outDir, "TransformRepositories", repository), 0o700)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// write TransformSettings
+	return writeFile(filepath.Join(outDir, "TransformRepositories", repository, prefix+name+".transform"), data)
+}
 
-	data, err = xml.MarshalIndent(trs, "", " ")
+func GenTransform(workingDir, org, author, prefix string, outDir string, name string, description string, inputEntity string, executable string, args []string, debug bool) {
+	err := GenTransformE(workingDir, org, author, prefix, outDir, name, description, inputEntity, executable, args, debug)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+// GenTransformE is the error returning variant of GenTransform.
+func GenTransformE(workingDir, org, author, prefix string, outDir string, name string, description string, inputEntity string, executable string, args []string, debug bool) error {
+	return GenTransformWithOptions(workingDir, org, author, prefix, outDir, name, description, inputEntity, executable, args, debug, DefaultTransformOptions(org))
+}
+
+// GenTransformWithOptions is like GenTransformE, but generates the transform configured by opts,
+// with the settings for a maltego client on opts.GOOS.
+func GenTransformWithOptions(workingDir, org, author, prefix string, outDir string, name string, description string, inputEntity string, executable string, args []string, debug bool, opts TransformOptions) error {
+	goos := opts.GOOS
+	if goos == "" {
+		goos = "linux"
+	}
+
+	var (
+		tr  = NewTransformWithOptions(org, author, prefix, name, description, inputEntity, opts)
+		trs = NewTransformSettingsForOS(goos, workingDir, args, debug, executable)
+	)
+
+	// write Transform
 
-	f, err = os.Create(filepath.Join(outDir, "TransformRepositories", "Local", prefix+name+".transformsettings"))
+	data, err := xml.MarshalIndent(tr, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal transform %s: %w", prefix+name, err)
 	}
 
-	_, err = f.Write(data)
+	err = writeFile(filepath.Join(outDir, "TransformRepositories", "Local", prefix+name+".transform"), data)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = f.Close()
+	// write TransformSettings
+
+	data, err = xml.MarshalIndent(trs, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal transform settings %s: %w", prefix+name, err)
 	}
+
+	return writeFile(filepath.Join(outDir, "TransformRepositories", "Local", prefix+name+".transformsettings"), data)
 }
 
+// GenTransformArchive will generate a configuration archive for maltego transforms.
+//
 // Directory structure:
 // .
 // ├── Servers
@@ -443,96 +701,89 @@ func GenTransform(workingDir, org, author, prefix string, outDir string, name st
 // │          └── ...
 // └── version.properties.
 func GenTransformArchive() {
+	if err := GenTransformArchiveE(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// GenTransformArchiveE is the error returning variant of GenTransformArchive.
+func GenTransformArchiveE() error {
+	return GenTransformArchiveWithOptions(ArchiveOptions{})
+}
+
+// GenTransformArchiveWithOptions generates the configuration archive for maltego transforms like GenTransformArchive,
+// using the provided options.
+func GenTransformArchiveWithOptions(opts ArchiveOptions) error {
 	// clean
 	_ = os.RemoveAll("transforms")
 
 	// create directories
-	_ = os.MkdirAll("transforms/Servers", 0o700)
-	_ = os.MkdirAll("transforms/TransformRepositories/Local", 0o700)
+	for _, dir := range []string{"transforms/Servers", "transforms/TransformRepositories/Local"} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
 
-	fVersion, err := os.Create("transforms/version.properties")
+	v, err := opts.version()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer func() {
-		if errClose := fVersion.Close(); errClose != nil {
-			fmt.Println(errClose)
-		}
-	}()
-
-	_, _ = fVersion.WriteString(`#
-#Sat Jun 13 21:48:54 CEST 2020
-maltego.client.version=4.2.11.13104
-maltego.client.subtitle=
-maltego.pandora.version=1.4.2
-maltego.client.name=Maltego Classic Eval
-maltego.mtz.version=1.0
-maltego.graph.version=1.2`)
+	err = writeVersionProperties("transforms", v)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("generated maltego transform archive")
+
+	return nil
 }
 
+// PackTransformArchive will zip the transforms directory into transforms.mtz.
 func PackTransformArchive() {
-	fmt.Println("packing maltego transform archive")
-
-	// zip and rename to: transforms.mtz
-	f, err := os.Create("transforms" + configFileExtension)
-	if err != nil {
+	if err := PackTransformArchiveE(); err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		errClose := f.Close()
-		if errClose != nil && !errors.Is(errClose, io.EOF) {
-			fmt.Println(errClose)
-		}
-	}()
-
-	w := zip.NewWriter(f)
+}
 
-	// add files to the archive
-	addFiles(w, "transforms", "")
+// PackTransformArchiveE is the error returning variant of PackTransformArchive.
+func PackTransformArchiveE() error {
+	fmt.Println("packing maltego transform archive")
 
-	err = w.Flush()
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = w.Close()
+	// zip and rename to: transforms.mtz
+	err := packArchive("transforms", "transforms"+configFileExtension, ArchiveOptions{})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	fmt.Println("packed maltego transform archive")
+
+	return nil
 }
 
+// PackMaltegoArchive will zip the directory with the given name into name.mtz.
 func PackMaltegoArchive(name string) {
-	fmt.Println("packing maltego " + name + " archive")
-
-	// zip and rename to: transforms.mtz
-	f, err := os.Create(name + configFileExtension)
-	if err != nil {
+	if err := PackMaltegoArchiveE(name); err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		errClose := f.Close()
-		if errClose != nil && !errors.Is(errClose, io.EOF) {
-			fmt.Println(errClose)
-		}
-	}()
+}
 
-	w := zip.NewWriter(f)
+// PackMaltegoArchiveE is the error returning variant of PackMaltegoArchive.
+func PackMaltegoArchiveE(name string) error {
+	return PackMaltegoArchiveWithOptions(name, ArchiveOptions{})
+}
 
-	// add files to the archive
-	addFiles(w, name, "")
+// PackMaltegoArchiveWithOptions will zip the directory with the given name into name.mtz, using the provided options.
+func PackMaltegoArchiveWithOptions(name string, opts ArchiveOptions) error {
+	fmt.Println("packing maltego " + name + " archive")
 
-	err = w.Flush()
+	// zip and rename to: name.mtz
+	err := packArchive(name, name+configFileExtension, opts)
 	if err != nil {
-		log.Fatal(err)
-	}
-	err = w.Close()
-	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	fmt.Println("packed maltego " + name + " archive")
+
+	return nil
 }
@@ -0,0 +1,85 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// isGzip reports whether the content coding is gzip.
+func isGzip(coding string) bool {
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	return coding == "gzip" || coding == "x-gzip"
+}
+
+// acceptsGzip reports whether the client accepts gzip compressed responses,
+// according to the Accept-Encoding header of the request.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			var (
+				name = coding
+				q    = 1.0
+			)
+			if i := strings.IndexByte(coding, ';'); i >= 0 {
+				name = coding[:i]
+				param := strings.TrimSpace(coding[i+1:])
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						q = v
+					}
+				}
+			}
+			if isGzip(name) && q > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gzipResponse returns a writer that compresses the response if the client accepts gzip,
+// and a function that must be called once the response has been written.
+// If gzip was not negotiated, w is returned unchanged.
+func gzipResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if !acceptsGzip(r) {
+		return w, func() {}
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+
+	gw := &gzipWriter{ResponseWriter: w, gz: gzip.NewWriter(w)}
+
+	return gw, func() {
+		if err := gw.gz.Close(); err != nil {
+			logger.Log("failed to write back compressed response", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+		}
+	}
+}
+
+// gzipWriter compresses everything written to the wrapped http.ResponseWriter.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	return w.gz.Write(data)
+}
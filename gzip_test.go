@@ -0,0 +1,168 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestMakeHandlerGzip(t *testing.T) {
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", t.RequestMessage.Entities.Items[0].Value)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/run/test", bytes.NewReader(gzipData(t, testRequest)))
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code, rec.Body.String())
+	}
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatal("unexpected content encoding", enc)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `<Entity Type="maltego.IPv4Address"><Value>example.com</Value>`) {
+		t.Fatal("unexpected response", string(out))
+	}
+}
+
+func TestMakeHandlerGzipNotNegotiated(t *testing.T) {
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	})
+
+	for _, accept := range []string{"", "identity", "gzip;q=0"} {
+		req := httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest))
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Fatal("unexpected content encoding", enc, "for", accept)
+		}
+		if out := rec.Body.String(); !strings.Contains(out, "<Value>93.184.216.34</Value>") {
+			t.Fatal("unexpected response", out)
+		}
+	}
+}
+
+func TestMakeHandlerGzipInvalid(t *testing.T) {
+	called := false
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		called = true
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if called {
+		t.Fatal("handler invoked for invalid request")
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("unexpected status", rec.Code)
+	}
+}
+
+func TestMakeHandlerGzipTooLarge(t *testing.T) {
+	defer func(size int64) {
+		MaxRequestBodySize = size
+	}(MaxRequestBodySize)
+	MaxRequestBodySize = 128
+
+	called := false
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		called = true
+		return nil
+	})
+
+	// compresses well below the limit, but exceeds it once decompressed
+	body := strings.Replace(testRequest, "example.com", strings.Repeat("a", 1024), 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/run/test", bytes.NewReader(gzipData(t, body)))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if called {
+		t.Fatal("handler invoked for oversized request")
+	}
+	if out := rec.Body.String(); !strings.Contains(out, `<Exception code="">request body exceeds the limit of 128 bytes</Exception>`) {
+		t.Fatal("missing exception", out)
+	}
+}
+
+func TestMakeHandlerGzipAtLimit(t *testing.T) {
+	defer func(size int64) {
+		MaxRequestBodySize = size
+	}(MaxRequestBodySize)
+	MaxRequestBodySize = int64(len(testRequest))
+
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/run/test", bytes.NewReader(gzipData(t, testRequest)))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code, rec.Body.String())
+	}
+}
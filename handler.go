@@ -14,15 +14,26 @@
 package maltego
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var transforms []string
 
+// MaxRequestBodySize is the maximum number of bytes read from the body of a transform request.
+// Larger requests are answered with an exception.
+var MaxRequestBodySize int64 = 4 << 20
+
 // RegisterTransform will register the provided handler in the http.DefaultServeMux
 // and collect the name for the route
 func RegisterTransform(handlerFunc http.HandlerFunc, name string) {
@@ -33,12 +44,15 @@ func RegisterTransform(handlerFunc http.HandlerFunc, name string) {
 // Home provides a simple greeting together with a listing of supported transforms.
 func Home(w http.ResponseWriter, r *http.Request) {
 
-	fmt.Println("RemoteAddr", r.RemoteAddr, "UserAgent", r.UserAgent(), "URI", r.RequestURI)
+	logger.Log("home", "remote", r.RemoteAddr, "userAgent", r.UserAgent(), "uri", r.RequestURI)
 
 	var routes string
 	for _, t := range transforms {
 		routes += "/run/" + t + "<br>"
 	}
+	if healthChecks {
+		routes += "<br>health checks:<br><a href=\"/healthz\">/healthz</a><br><a href=\"/readyz\">/readyz</a><br>"
+	}
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -47,77 +61,339 @@ func Home(w http.ResponseWriter, r *http.Request) {
 
 // MakeHandler is util to create a http.HandlerFunc, that will get the deserialized MaltegoMessage from a request,
 // and can populate the Transform response, which will be written back into the connection as soon as the handler exits.
+// Requests must contain exactly one entity, so handlers can safely access the first one, use MakeMultiHandler to accept more.
+// Exactly one response is written per request: if the handler writes its own response into w, the transform is discarded.
 func MakeHandler(handler func(w http.ResponseWriter, r *http.Request, t *Transform)) http.HandlerFunc {
+	return makeHandler(true, nil, handler)
+}
+
+// MakeMultiHandler is like MakeHandler, but accepts requests with one or more entities,
+// which are sent by maltego when running a transform on a selection of several entities.
+func MakeMultiHandler(handler func(w http.ResponseWriter, r *http.Request, t *Transform)) http.HandlerFunc {
+	return makeHandler(false, nil, handler)
+}
+
+// MakeTypedHandler is like MakeHandler, but verifies that the input entity has the expected type before invoking the handler.
+// The "maltego." prefix of the type is optional, so "maltego.Domain" and "Domain" are considered equal.
+// If the type does not match, an exception is sent back to maltego.
+func MakeTypedHandler(inputType string, handler func(w http.ResponseWriter, r *http.Request, t *Transform)) http.HandlerFunc {
+	return makeHandler(true, func(t *Transform) error {
+		typ := t.RequestMessage.Entities.Items[0].Type
+		if !sameEntityType(typ, inputType) {
+			return fmt.Errorf("invalid input entity type %s, expected %s", typ, inputType)
+		}
+		return nil
+	}, handler)
+}
+
+// sameEntityType reports whether both entity types are equal, ignoring the optional "maltego." prefix.
+func sameEntityType(a, b string) bool {
+	return strings.TrimPrefix(a, "maltego.") == strings.TrimPrefix(b, "maltego.")
+}
+
+// makeHandler creates the handler for MakeHandler, MakeMultiHandler and MakeTypedHandler.
+// If single is set, requests with more than one entity are rejected.
+// If check is not nil and returns an error for the request, the error is sent back as an exception instead of invoking the handler.
+func makeHandler(single bool, check func(t *Transform) error, handler func(w http.ResponseWriter, r *http.Request, t *Transform)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		fmt.Println("RemoteAddr", r.RemoteAddr, "UserAgent", r.UserAgent(), "URI", r.RequestURI)
+		start := time.Now()
 
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("please send a POST request to this endpoint"))
+		w, done := gzipResponse(w, r)
+		defer done()
+
+		t, size, ok := readTransform(w, r, single)
+		if !ok {
 			return
 		}
+		defer releaseTransform(t)
 
-		// read request body
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			fmt.Println("failed to read request body:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if check != nil {
+			if err := check(t); err != nil {
+				logger.Log("invalid request", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+				t.AddException(err.Error(), "")
+				recordTransform(r, t)
+				writeOutput(w, r, exceptions(r, t), size, start)
+				return
+			}
+		}
+
+		// invoke the user provided handler
+		hw := &handlerWriter{ResponseWriter: w}
+		handler(hw, r, t)
+
+		// a handler that has sent its own response, e.g. an error with http.Error,
+		// must not get the transform appended to it
+		if hw.wrote {
+			logger.Log("handler has written the response, discarding transform", "remote", r.RemoteAddr, "transform", transformName(r))
+			logRequest(r, size, start)
 			return
 		}
-		defer r.Body.Close()
 
-		fmt.Println(r.RemoteAddr, "body contains", len(body), "bytes of data")
-		if len(body) == 0 {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("empty body received. please add data"))
+		t.addComplete()
+		recordTransform(r, t)
+
+		writeOutput(w, r, output(r, t), size, start)
+	}
+}
+
+// handlerWriter records whether the handler has written a response itself.
+type handlerWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *handlerWriter) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *handlerWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(data)
+}
+
+// MakeHandlerCtx is like MakeHandler, but invokes a handler that receives the context of the request,
+// which is canceled when the client disconnects or the deadline of the request is exceeded.
+// If the handler returns an error, it is sent back to maltego as an exception instead of the response.
+func MakeHandlerCtx(handler func(ctx context.Context, t *Transform) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+
+		w, done := gzipResponse(w, r)
+		defer done()
+
+		t, size, ok := readTransform(w, r, true)
+		if !ok {
 			return
 		}
+		defer releaseTransform(t)
+
+		// invoke the user provided handler
+		var out string
+		if err := handler(r.Context(), t); err != nil {
+			t.AddException(err.Error(), "")
+			recordTransform(r, t)
+			out = exceptions(r, t)
+		} else {
+			t.addComplete()
+			recordTransform(r, t)
+			out = output(r, t)
+		}
+
+		writeOutput(w, r, out, size, start)
+	}
+}
+
+// writeOutput writes the serialized transform back into the connection and logs the request.
+func writeOutput(w http.ResponseWriter, r *http.Request, out string, size int, start time.Time) {
+
+	dump([]byte(out), response)
+
+	_, err := io.WriteString(w, out)
+	if err != nil {
+		logger.Log("failed to write back response", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+		return
+	}
+
+	logRequest(r, size, start)
+}
+
+// output returns the XML representation of the transform.
+// If it can not be marshaled, an exception with the error is returned instead.
+func output(r *http.Request, t *Transform) string {
+	out, err := t.ReturnOutputE()
+	if err != nil {
+		logger.Log("failed to marshal transform", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+		recordException(r)
+		return exceptionOutput("failed to marshal transform: " + err.Error())
+	}
+	return out
+}
 
-		// parse the transform from the request body bytes
-		t := &Transform{}
-		err = xml.Unmarshal(body, t)
+// exceptions returns the XML representation of the exceptions of the transform.
+// If they can not be marshaled, an exception with the error is returned instead.
+func exceptions(r *http.Request, t *Transform) string {
+	out, err := t.ThrowExceptionsE()
+	if err != nil {
+		logger.Log("failed to marshal exceptions", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+		recordException(r)
+		return exceptionOutput("failed to marshal exceptions: " + err.Error())
+	}
+	return out
+}
+
+// exceptionOutput returns the XML representation of a single exception with the given message.
+func exceptionOutput(msg string) string {
+	t := &Transform{}
+	t.AddException(msg, "")
+	return t.ThrowExceptions()
+}
+
+// transformName returns the name of the transform addressed by the request path.
+func transformName(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/run/")
+}
+
+// logRequest logs a handled request with the size of its body and the time it took to process it.
+func logRequest(r *http.Request, size int, start time.Time) {
+	logger.Log("handled request",
+		"remote", r.RemoteAddr,
+		"transform", transformName(r),
+		"size", size,
+		"duration", time.Since(start),
+	)
+}
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// readTransform deserializes the transform from the request body and returns it together with the size of the body.
+// The request must contain at least one entity, if single is set exactly one.
+// If the request is invalid, an error is written to w and false is returned.
+func readTransform(w http.ResponseWriter, r *http.Request, single bool) (*Transform, int, bool) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("please send a POST request to this endpoint"))
+		return nil, 0, false
+	}
+
+	// read request body
+	defer r.Body.Close()
+
+	body := &limitReader{r: r.Body, n: MaxRequestBodySize}
+
+	// decompress gzip encoded requests, limiting the decompressed size as well
+	decoded := body
+	if isGzip(r.Header.Get("Content-Encoding")) {
+		gz, err := gzip.NewReader(body)
+		if err == io.EOF {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("empty body received. please add data"))
+			return nil, 0, false
+		}
+		if errors.Is(err, errBodyTooLarge) {
+			bodyTooLarge(w, r)
+			return nil, 0, false
+		}
 		if err != nil {
-			dump(body, request)
-			fmt.Println("failed to unmarshal transform:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			logger.Log("failed to decompress request body", "remote", r.RemoteAddr, "transform", transformName(r), "error", err)
+			http.Error(w, "invalid gzip request body: "+err.Error(), http.StatusBadRequest)
+			return nil, 0, false
 		}
+		defer gz.Close()
 
-		// request always has the first entity set
-		if t.RequestMessage == nil || len(t.RequestMessage.Entities.Items) != 1 {
-			dump(body, request)
-			if t.RequestMessage == nil {
-				fmt.Println("no RequestMessage provided")
-			} else {
-				fmt.Println("invalid number of entities:", len(t.RequestMessage.Entities.Items))
-			}
+		decoded = &limitReader{r: gz, n: MaxRequestBodySize}
+	}
 
-			http.Error(w, "malformed RequestMessage", http.StatusBadRequest)
-			return
+	br := bufio.NewReader(decoded)
+
+	// strip a leading byte order mark and whitespace added by some clients and proxies
+	if b, _ := br.Peek(len(utf8BOM)); bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	skipSpace(br)
+
+	if _, err := br.Peek(1); err == io.EOF {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("empty body received. please add data"))
+		return nil, 0, false
+	}
+
+	// keep a copy of the body only if it will be dumped
+	var (
+		raw bytes.Buffer
+		src io.Reader = br
+	)
+	if debug() {
+		src = io.TeeReader(br, &raw)
+	}
+
+	// decode the transform while reading the request body
+	t := newTransform()
+	err := xml.NewDecoder(src).Decode(t)
+	if err != nil {
+		releaseTransform(t)
+
+		if errors.Is(err, errBodyTooLarge) {
+			bodyTooLarge(w, r)
+			return nil, 0, false
 		}
 
-		dump(body, request)
+		dump(raw.Bytes(), request)
+		logger.Log("failed to unmarshal transform", "remote", r.RemoteAddr, "transform", transformName(r), "size", body.read, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
 
-		// invoke the user provided handler
-		handler(w, r, t)
+	size := int(body.read)
 
-		if debug {
-			formatted, err := xml.MarshalIndent(t, "", "  ")
-			if err != nil {
-				log.Println("failed to marshal transform: ", err)
-			}
-			dump(formatted, response)
+	// request always has the first entity set
+	if t.RequestMessage == nil || len(t.RequestMessage.Entities.Items) == 0 || (single && len(t.RequestMessage.Entities.Items) != 1) {
+		dump(raw.Bytes(), request)
+		if t.RequestMessage == nil {
+			logger.Log("no RequestMessage provided", "remote", r.RemoteAddr, "transform", transformName(r))
+		} else {
+			logger.Log("invalid number of entities", "remote", r.RemoteAddr, "transform", transformName(r), "entities", len(t.RequestMessage.Entities.Items))
 		}
 
-		t.AddUIMessage("complete", UIMessageInform)
+		releaseTransform(t)
+		http.Error(w, "malformed RequestMessage", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	dump(raw.Bytes(), request)
+
+	return t, size, true
+}
 
-		// write back the response
-		_, err = fmt.Fprintf(w, t.ReturnOutput())
+// bodyTooLarge answers a request whose body exceeds MaxRequestBodySize with an exception.
+// Like for WithAuth, it is sent with status 200, since maltego only displays the exception messages of successful responses.
+func bodyTooLarge(w http.ResponseWriter, r *http.Request) {
+	logger.Log("request body too large", "remote", r.RemoteAddr, "transform", transformName(r), "limit", MaxRequestBodySize)
+
+	recordException(r)
+	io.WriteString(w, exceptionOutput("request body exceeds the limit of "+strconv.FormatInt(MaxRequestBodySize, 10)+" bytes"))
+}
+
+// skipSpace discards leading whitespace from br.
+func skipSpace(br *bufio.Reader) {
+	for {
+		c, err := br.ReadByte()
 		if err != nil {
-			fmt.Println("failed to write back response:", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			br.UnreadByte()
+			return
+		}
+	}
+}
+
+// errBodyTooLarge is returned by limitReader when the data exceeds its limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitReader reads at most n bytes from r and counts the bytes read.
+// Unlike io.LimitReader, it returns errBodyTooLarge if r holds more than n bytes,
+// so that data of exactly the limit size can be told apart from an overrun.
+type limitReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	// read one byte past the limit to detect an overrun
+	if remaining := l.n - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.n {
+		l.read = l.n
+		return n - 1, errBodyTooLarge
 	}
+	return n, err
 }
@@ -0,0 +1,515 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRequest = `<MaltegoMessage>
+	<MaltegoTransformRequestMessage>
+		<Entities>
+			<Entity Type="maltego.Domain">
+				<Value>example.com</Value>
+				<Weight>0</Weight>
+			</Entity>
+		</Entities>
+		<Limits SoftLimit="12" HardLimit="12"/>
+	</MaltegoTransformRequestMessage>
+</MaltegoMessage>`
+
+// serveTestRequest posts the body to the handler and returns the recorded response.
+func serveTestRequest(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(body)))
+	return rec
+}
+
+func TestMakeHandlerCtx(t *testing.T) {
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		if ctx == nil {
+			return errors.New("missing context")
+		}
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	})
+
+	rec := serveTestRequest(h, testRequest)
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code)
+	}
+
+	out := rec.Body.String()
+	if !strings.Contains(out, "<Value>93.184.216.34</Value>") || !strings.Contains(out, `<UIMessage MessageType="Inform">complete</UIMessage>`) {
+		t.Fatal("unexpected response", out)
+	}
+	if strings.Contains(out, "<Exception ") {
+		t.Fatal("unexpected exception", out)
+	}
+}
+
+func TestMakeHandlerCtxError(t *testing.T) {
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return errors.New("lookup failed")
+	})
+
+	rec := serveTestRequest(h, testRequest)
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code)
+	}
+
+	out := rec.Body.String()
+	if !strings.Contains(out, `<Exception code="">lookup failed</Exception>`) {
+		t.Fatal("missing exception", out)
+	}
+	if strings.Contains(out, "MaltegoTransformResponseMessage") {
+		t.Fatal("unexpected response message", out)
+	}
+}
+
+func TestHandlerLogging(t *testing.T) {
+	var entries []map[string]interface{}
+	SetLogger(LoggerFunc(func(msg string, keyvals ...interface{}) {
+		entry := map[string]interface{}{"msg": msg}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			entry[keyvals[i].(string)] = keyvals[i+1]
+		}
+		entries = append(entries, entry)
+	}))
+	t.Cleanup(func() {
+		SetLogger(nil)
+	})
+
+	h := MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run/toIP", strings.NewReader(testRequest))
+	req.RemoteAddr = "10.0.0.1:4242"
+	h(rec, req)
+
+	if len(entries) != 1 {
+		t.Fatal("unexpected log entries", entries)
+	}
+
+	e := entries[0]
+	if e["msg"] != "handled request" || e["remote"] != "10.0.0.1:4242" || e["transform"] != "toIP" || e["size"] != len(testRequest) {
+		t.Fatal("unexpected log entry", e)
+	}
+	if _, ok := e["duration"].(time.Duration); !ok {
+		t.Fatal("missing duration", e)
+	}
+}
+
+func TestMakeHandlerBodyTooLarge(t *testing.T) {
+	defer func(size int64) {
+		MaxRequestBodySize = size
+	}(MaxRequestBodySize)
+	MaxRequestBodySize = 64
+
+	called := false
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		called = true
+		return nil
+	})
+
+	rec := serveTestRequest(h, testRequest)
+	if called {
+		t.Fatal("handler invoked for oversized request")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code)
+	}
+	if out := rec.Body.String(); !strings.Contains(out, `<Exception code="">request body exceeds the limit of 64 bytes</Exception>`) {
+		t.Fatal("missing exception", out)
+	}
+}
+
+func TestMakeHandlerBodyAtLimit(t *testing.T) {
+	defer func(size int64) {
+		MaxRequestBodySize = size
+	}(MaxRequestBodySize)
+	MaxRequestBodySize = int64(len(testRequest))
+
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		return nil
+	})
+
+	rec := serveTestRequest(h, testRequest)
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code, rec.Body.String())
+	}
+
+	// a malformed body of exactly the limit size is a parse error, not an overrun
+	malformed := strings.Replace(testRequest, "</MaltegoMessage>", "</MaltegoMessagX>", 1)
+
+	rec = serveTestRequest(h, malformed)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("unexpected status", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "exceeds the limit") {
+		t.Fatal("malformed request reported as too large", rec.Body.String())
+	}
+}
+
+func TestMakeHandlerMarshalError(t *testing.T) {
+	failMarshal(t)
+
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	})
+
+	out := serveTestRequest(h, testRequest).Body.String()
+	if !strings.Contains(out, `<Exception code="">failed to marshal transform: marshal failed</Exception>`) {
+		t.Fatal("missing exception", out)
+	}
+}
+
+func TestMakeHandlerByteOrderMark(t *testing.T) {
+	var value string
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		value = t.RequestMessage.Entities.Items[0].Value
+		return nil
+	})
+
+	rec := serveTestRequest(h, "\xEF\xBB\xBF\r\n"+`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+testRequest)
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code, rec.Body.String())
+	}
+	if value != "example.com" {
+		t.Fatal("unexpected request entity value", value)
+	}
+}
+
+func TestReadTransformMatchesUnmarshal(t *testing.T) {
+	body := `<MaltegoMessage>
+	<MaltegoTransformRequestMessage>
+		<Entities>
+			<Entity Type="maltego.Domain">
+				<Value>example.com &amp; ünïcode</Value>
+				<Weight>0</Weight>
+				<AdditionalFields>
+					<Field Name="fqdn" DisplayName="Domain Name">www.example.com</Field>
+					<Field Name="whois-info" DisplayName="WHOIS Info"><![CDATA[<registrar>]]></Field>
+				</AdditionalFields>
+			</Entity>
+			<Entity Type="maltego.IPv4Address">
+				<Value>93.184.216.34</Value>
+				<Weight>100</Weight>
+			</Entity>
+		</Entities>
+		<Limits SoftLimit="12" HardLimit="255"/>
+		<TransformFields>
+			<Field Name="apikey">secret</Field>
+		</TransformFields>
+	</MaltegoTransformRequestMessage>
+</MaltegoMessage>`
+
+	var exp Transform
+	if err := xml.Unmarshal([]byte(body), &exp); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	tr, size, ok := readTransform(rec, httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(body)), false)
+	if !ok {
+		t.Fatal("failed to read transform", rec.Code, rec.Body.String())
+	}
+	if size != len(body) {
+		t.Fatal("unexpected size", size, len(body))
+	}
+	if !reflect.DeepEqual(tr, &exp) {
+		t.Fatalf("decoded transform differs from unmarshal result:\n%+v\n%+v", tr.RequestMessage, exp.RequestMessage)
+	}
+}
+
+func TestMakeTypedHandler(t *testing.T) {
+	for inputType, valid := range map[string]bool{
+		"maltego.Domain":      true,
+		"Domain":              true,
+		"maltego.IPv4Address": false,
+	} {
+		called := false
+		h := MakeTypedHandler(inputType, func(w http.ResponseWriter, r *http.Request, t *Transform) {
+			called = true
+			t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		})
+
+		out := serveTestRequest(h, testRequest).Body.String()
+		if called != valid {
+			t.Fatal("unexpected handler invocation for", inputType, called)
+		}
+
+		if valid {
+			if !strings.Contains(out, "<Value>93.184.216.34</Value>") {
+				t.Fatal("unexpected response for", inputType, out)
+			}
+		} else {
+			if !strings.Contains(out, `<Exception code="">invalid input entity type maltego.Domain, expected maltego.IPv4Address</Exception>`) {
+				t.Fatal("missing exception for", inputType, out)
+			}
+		}
+	}
+}
+
+func TestMakeMultiHandler(t *testing.T) {
+	body := `<MaltegoMessage>
+	<MaltegoTransformRequestMessage>
+		<Entities>
+			<Entity Type="maltego.Domain"><Value>example.com</Value><Weight>0</Weight></Entity>
+			<Entity Type="maltego.Domain"><Value>example.org</Value><Weight>0</Weight></Entity>
+			<Entity Type="maltego.Domain"><Value>example.net</Value><Weight>0</Weight></Entity>
+		</Entities>
+	</MaltegoTransformRequestMessage>
+</MaltegoMessage>`
+
+	var values []string
+	h := MakeMultiHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		for _, e := range t.RequestMessage.Entities.Items {
+			values = append(values, e.Value)
+		}
+	})
+
+	rec := serveTestRequest(h, body)
+	if rec.Code != http.StatusOK {
+		t.Fatal("unexpected status", rec.Code)
+	}
+	if strings.Join(values, ",") != "example.com,example.org,example.net" {
+		t.Fatal("unexpected request entities", values)
+	}
+
+	// the single entity handler rejects the request
+	rec = serveTestRequest(MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+	}), body)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("unexpected status", rec.Code)
+	}
+
+	// requests without entities are rejected
+	rec = serveTestRequest(h, `<MaltegoMessage><MaltegoTransformRequestMessage><Entities></Entities></MaltegoTransformRequestMessage></MaltegoMessage>`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("unexpected status", rec.Code)
+	}
+}
+
+func TestMakeHandlerComplete(t *testing.T) {
+	const complete = `<UIMessage MessageType="Inform">complete</UIMessage>`
+
+	for name, tc := range map[string]struct {
+		handler  func(w http.ResponseWriter, r *http.Request, t *Transform)
+		complete bool
+	}{
+		"normal": {
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+			},
+			complete: true,
+		},
+		"fatal": {
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+				t.AddUIMessage("lookup failed", UIMessageFatal)
+			},
+		},
+		"exception": {
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddException("lookup failed", "")
+			},
+		},
+		"partial error": {
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddUIMessage("some lookups failed", UIMessagePartialError)
+			},
+			complete: true,
+		},
+	} {
+		out := serveTestRequest(MakeHandler(tc.handler), testRequest).Body.String()
+		if strings.Contains(out, complete) != tc.complete {
+			t.Fatal("unexpected complete message for", name, out)
+		}
+	}
+}
+
+func TestMakeHandlerSuppressComplete(t *testing.T) {
+	const complete = `<UIMessage MessageType="Inform">complete</UIMessage>`
+
+	for _, suppress := range []bool{true, false} {
+		h := MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+			t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+			t.AddUIMessage("resolved 1 address", UIMessageInform)
+			if suppress {
+				t.SuppressComplete()
+			}
+		})
+
+		out := serveTestRequest(h, testRequest).Body.String()
+		if strings.Contains(out, complete) == suppress {
+			t.Fatal("unexpected complete message with suppress", suppress, out)
+		}
+		if !strings.Contains(out, `<UIMessage MessageType="Inform">resolved 1 address</UIMessage>`) {
+			t.Fatal("missing own message", out)
+		}
+	}
+}
+
+func TestMakeHandlerPercentValues(t *testing.T) {
+	h := MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		t.AddEntity("maltego.URL", "https://example.com/%s/%d/100%25")
+		t.AddUIMessage("progress: 100%", UIMessageInform)
+	})
+
+	out := serveTestRequest(h, testRequest).Body.String()
+	if strings.Contains(out, "%!") {
+		t.Fatal("response has been formatted", out)
+	}
+	if !strings.Contains(out, "<Value>https://example.com/%s/%d/100%25</Value>") || !strings.Contains(out, `<UIMessage MessageType="Inform">progress: 100%</UIMessage>`) {
+		t.Fatal("unexpected response", out)
+	}
+
+	var tr Transform
+	if err := xml.Unmarshal([]byte(out), &tr); err != nil {
+		t.Fatal("invalid response XML", err)
+	}
+}
+
+// writeCountingRecorder counts the calls to WriteHeader, including the implicit ones of Write.
+type writeCountingRecorder struct {
+	*httptest.ResponseRecorder
+	headers int
+	written bool
+}
+
+func (w *writeCountingRecorder) WriteHeader(status int) {
+	w.headers++
+	w.written = true
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *writeCountingRecorder) Write(data []byte) (int, error) {
+	if !w.written {
+		w.headers++
+		w.written = true
+	}
+	return w.ResponseRecorder.Write(data)
+}
+
+func TestMakeHandlerSingleResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body    string
+		handler func(w http.ResponseWriter, r *http.Request, t *Transform)
+		status  int
+		exp     string
+	}{
+		"malformed request": {
+			body: "<MaltegoMessage><MaltegoTransformRequestMessage>",
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+			},
+			status: http.StatusBadRequest,
+			exp:    "XML syntax error on line 1: unexpected EOF\n",
+		},
+		"missing entity": {
+			body: "<MaltegoMessage><MaltegoTransformRequestMessage></MaltegoTransformRequestMessage></MaltegoMessage>",
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+			},
+			status: http.StatusBadRequest,
+			exp:    "malformed RequestMessage\n",
+		},
+		"handler error": {
+			body: testRequest,
+			handler: func(w http.ResponseWriter, r *http.Request, t *Transform) {
+				t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+				http.Error(w, "lookup failed", http.StatusBadGateway)
+			},
+			status: http.StatusBadGateway,
+			exp:    "lookup failed\n",
+		},
+	} {
+		rec := &writeCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		MakeHandler(tc.handler)(rec, httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(tc.body)))
+
+		if rec.headers != 1 {
+			t.Fatal("expected a single response for", name, "got", rec.headers)
+		}
+		if rec.Code != tc.status || rec.Body.String() != tc.exp {
+			t.Fatal("unexpected response for", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// captureStdout returns everything written to stdout while running fn.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+
+	fn()
+
+	w.Close()
+	return string(<-done)
+}
+
+func TestSetDebug(t *testing.T) {
+	defer SetDebug(false)
+
+	h := MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+	})
+
+	out := captureStdout(t, func() {
+		serveTestRequest(h, testRequest)
+	})
+	if out != "" {
+		t.Fatal("unexpected output with debugging disabled", out)
+	}
+
+	SetDebug(true)
+
+	out = captureStdout(t, func() {
+		serveTestRequest(h, testRequest)
+	})
+	if !strings.Contains(out, "================== REQUEST ====================\n"+testRequest) || !strings.Contains(out, "================== RESPONSE ====================") || !strings.Contains(out, "<Value>93.184.216.34</Value>") {
+		t.Fatal("missing dump with debugging enabled", out)
+	}
+}
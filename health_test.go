@@ -0,0 +1,53 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterHealthChecks(t *testing.T) {
+	RegisterHealthChecks()
+	t.Cleanup(func() {
+		SetReady(false)
+	})
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Fatal("unexpected status for /healthz", code)
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatal("unexpected status for /readyz before being ready", code)
+	}
+
+	SetReady(true)
+
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Fatal("unexpected status for /readyz", code)
+	}
+
+	rec := httptest.NewRecorder()
+	Home(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), `<a href="/healthz">/healthz</a>`) {
+		t.Fatal("missing health check links", rec.Body.String())
+	}
+}
@@ -14,8 +14,17 @@
 package maltego
 
 import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 var icon = `<Icon>
@@ -24,19 +33,199 @@ var icon = `<Icon>
 
 // CreateXMLIconFile will create the XML structure at the given path.
 func CreateXMLIconFile(path string) {
+	if err := CreateXMLIconFileE(path); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// CreateXMLIconFileE is the error returning variant of CreateXMLIconFile.
+func CreateXMLIconFileE(path string) error {
 	// create XML info file for maltego
-	fXML, err := os.Create(path + ".xml")
+	return writeFile(path+".xml", []byte(icon))
+}
+
+// RecolorIcon reads the monochrome SVG or PNG icon at src and returns it recolored to c.
+// The image type is determined by the file extension, every other extension than .svg is decoded as PNG.
+// For SVG icons all fill and stroke colors except none are replaced,
+// PNG icons keep the transparency of each pixel, but their color is replaced.
+func RecolorIcon(src string, c color.Color) ([]byte, error) {
+	data, err := os.ReadFile(src)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	return recolorIcon(data, filepath.Ext(src), c)
+}
+
+// recolorIcon recolors the icon data with the given file extension to c.
+func recolorIcon(data []byte, ext string, c color.Color) ([]byte, error) {
+	if strings.EqualFold(ext, ".svg") {
+		return recolorSVG(data, c), nil
+	}
+
+	return recolorPNG(data, c)
+}
+
+var (
+	svgPaint     = regexp.MustCompile(`\b(fill|stroke)(="|='|:\s*)([^"';]*)`)
+	svgRootPaint = regexp.MustCompile(`<svg\b[^>]*\bfill=`)
+	svgRoot      = regexp.MustCompile(`<svg\b`)
+)
+
+// recolorSVG replaces the fill and stroke colors of the SVG with c.
+// If the root element has no fill color, one is added, as shapes are filled black by default.
+func recolorSVG(data []byte, c color.Color) []byte {
+	var (
+		n   = color.NRGBAModel.Convert(c).(color.NRGBA)
+		hex = fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	)
+
+	data = svgPaint.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := svgPaint.FindSubmatch(m)
+		if v := strings.TrimSpace(string(sub[3])); v == "" || v == "none" {
+			return m
+		}
+		return []byte(string(sub[1]) + string(sub[2]) + hex)
+	})
+
+	if !svgRootPaint.Match(data) {
+		if loc := svgRoot.FindIndex(data); loc != nil {
+			data = append(data[:loc[1]:loc[1]], append([]byte(` fill="`+hex+`"`), data[loc[1]:]...)...)
+		}
 	}
 
-	_, err = fXML.WriteString(icon)
+	return data
+}
+
+// recolorPNG replaces the color of every pixel of the PNG with c, keeping its transparency.
+func recolorPNG(data []byte, c color.Color) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to decode icon: %w", err)
+	}
+
+	var (
+		n      = color.NRGBAModel.Convert(c).(color.NRGBA)
+		bounds = img.Bounds()
+		out    = image.NewNRGBA(bounds)
+	)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA).A
+			out.SetNRGBA(x, y, color.NRGBA{R: n.R, G: n.G, B: n.B, A: uint8(uint16(a) * uint16(n.A) / 0xff)})
+		}
 	}
 
-	err = fXML.Close()
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("failed to encode icon: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GenerateIconSizes reads the PNG image at src and writes it scaled to each of the icon sizes used by maltego.
+// The 16 pixel variant is written to dstBase.png, all others to dstBase<size>.png,
+// which is the naming expected for the icons of an entity.
+// Non square images are stretched to a square.
+func GenerateIconSizes(src string, dstBase string) error {
+	f, err := os.Open(src)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode icon %s: %w", src, err)
+	}
+
+	for _, size := range iconSizes {
+		n, errConv := strconv.Atoi(size)
+		if errConv != nil {
+			return errConv
+		}
+
+		dst := dstBase + size + ".png"
+		if size == "16" {
+			dst = dstBase + ".png"
+		}
+
+		var buf bytes.Buffer
+		if err = png.Encode(&buf, resizeImage(img, n, n)); err != nil {
+			return fmt.Errorf("failed to encode icon %s: %w", dst, err)
+		}
+
+		if err = writeFile(dst, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resizeImage scales img to width x height.
+// Each pixel of the result is the average of the source pixels it covers, weighted by their coverage,
+// which avoids the aliasing of nearest neighbor sampling when scaling down.
+func resizeImage(img image.Image, width, height int) *image.NRGBA {
+	var (
+		b   = img.Bounds()
+		out = image.NewNRGBA(image.Rect(0, 0, width, height))
+		sx  = float64(b.Dx()) / float64(width)
+		sy  = float64(b.Dy()) / float64(height)
+	)
+
+	for y := 0; y < height; y++ {
+		y0, y1 := float64(y)*sy, float64(y+1)*sy
+
+		for x := 0; x < width; x++ {
+			x0, x1 := float64(x)*sx, float64(x+1)*sx
+
+			var r, g, bl, a, total float64
+			for py := int(y0); float64(py) < y1; py++ {
+				wy := overlap(y0, y1, py)
+
+				for px := int(x0); float64(px) < x1; px++ {
+					w := wy * overlap(x0, x1, px)
+
+					// RGBA returns alpha premultiplied values, so transparent pixels do not darken the result
+					cr, cg, cb, ca := img.At(b.Min.X+px, b.Min.Y+py).RGBA()
+					r += float64(cr) * w
+					g += float64(cg) * w
+					bl += float64(cb) * w
+					a += float64(ca) * w
+					total += w
+				}
+			}
+
+			if total == 0 || a == 0 {
+				continue
+			}
+
+			out.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r/a*0xff + 0.5),
+				G: uint8(g/a*0xff + 0.5),
+				B: uint8(bl/a*0xff + 0.5),
+				A: uint8(a/total/0xffff*0xff + 0.5),
+			})
+		}
+	}
+
+	return out
+}
+
+// overlap returns the length of the overlap between the interval [lo, hi) and the pixel at p.
+func overlap(lo, hi float64, p int) float64 {
+	start, end := float64(p), float64(p+1)
+	if lo > start {
+		start = lo
+	}
+	if hi < end {
+		end = hi
+	}
+	if end < start {
+		return 0
 	}
+	return end - start
 }
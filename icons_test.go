@@ -0,0 +1,194 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRecolorIconSVG(t *testing.T) {
+	for _, tc := range []struct {
+		in, exp string
+	}{
+		{
+			in:  `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="none"/><path d="M12 2L2 22h20z"/></svg>`,
+			exp: `<svg fill="#ff8000" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="none"/><path d="M12 2L2 22h20z"/></svg>`,
+		},
+		{
+			in:  `<svg fill="#000000" viewBox="0 0 24 24"><path fill='black' stroke="#000" d="M12 2L2 22h20z"/><circle style="fill:#000;stroke:none;fill-opacity:0.5" r="2"/></svg>`,
+			exp: `<svg fill="#ff8000" viewBox="0 0 24 24"><path fill='#ff8000' stroke="#ff8000" d="M12 2L2 22h20z"/><circle style="fill:#ff8000;stroke:none;fill-opacity:0.5" r="2"/></svg>`,
+		},
+	} {
+		src := filepath.Join(t.TempDir(), "icon.svg")
+		if err := os.WriteFile(src, []byte(tc.in), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := RecolorIcon(src, color.RGBA{R: 0xff, G: 0x80, A: 0xff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.exp {
+			t.Fatal("unexpected result", string(data))
+		}
+	}
+}
+
+// testPNG returns a 2x1 PNG with an opaque black and a transparent pixel.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{A: 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 0xff, G: 0xff, B: 0xff})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRecolorIconPNG(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "icon.png")
+	if err := os.WriteFile(src, testPNG(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := RecolorIcon(src, color.NRGBA{R: 0xff, A: 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := color.NRGBAModel.Convert(img.At(0, 0)); c != (color.NRGBA{R: 0xff, A: 0xff}) {
+		t.Fatal("unexpected color for opaque pixel", c)
+	}
+	if _, _, _, a := img.At(1, 0).RGBA(); a != 0 {
+		t.Fatal("transparent pixel has become visible", a)
+	}
+
+	if err = os.WriteFile(src, []byte("not a png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RecolorIcon(src, color.Black); err == nil {
+		t.Fatal("expected error for invalid image")
+	}
+}
+
+func TestGenEntityIconColor(t *testing.T) {
+	outDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(outDir, "Entities"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	src := fstest.MapFS{
+		"icons/router.svg": {Data: []byte(`<svg viewBox="0 0 24 24"><path d="M12 2L2 22h20z"/></svg>`)},
+	}
+
+	err := GenEntityFSE(src, GenEntityConfig{
+		IconSet:   "icons",
+		Category:  "Test",
+		Ident:     "test",
+		Prefix:    "test.",
+		OutDir:    outDir,
+		Name:      "Interface",
+		Icon:      "router",
+		Color:     "red",
+		IconColor: color.RGBA{R: 0xff, A: 0xff},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "Icons", "test", "router_red.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `<svg fill="#ff0000" viewBox="0 0 24 24"><path d="M12 2L2 22h20z"/></svg>`; string(data) != exp {
+		t.Fatal("unexpected icon", string(data))
+	}
+}
+
+func TestGenerateIconSizes(t *testing.T) {
+	dir := t.TempDir()
+
+	// left half opaque red, right half transparent
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "source.png")
+	if err := os.WriteFile(src, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dstBase := filepath.Join(dir, "router")
+	if err := GenerateIconSizes(src, dstBase); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range map[string]int{
+		"router.png":   16,
+		"router24.png": 24,
+		"router32.png": 32,
+		"router48.png": 48,
+		"router96.png": 96,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b := out.Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Fatal("unexpected dimensions for", name, b)
+		}
+		if c := color.NRGBAModel.Convert(out.At(0, size/2)); c != (color.NRGBA{R: 0xff, A: 0xff}) {
+			t.Fatal("unexpected color of left pixel for", name, c)
+		}
+		if _, _, _, a := out.At(size-1, size/2).RGBA(); a != 0 {
+			t.Fatal("unexpected alpha of right pixel for", name, a)
+		}
+	}
+
+	if err := GenerateIconSizes(filepath.Join(dir, "missing.png"), dstBase); err == nil {
+		t.Fatal("expected error for missing source")
+	}
+}
@@ -14,20 +14,75 @@
 package maltego
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"os"
+	"strconv"
 	"strings"
 )
 
 // handles some characters that would cause errors
 var replacer = strings.NewReplacer("&amp;", "&", "\\=", "=")
 
+// replaces unix, windows and old mac line endings with spaces
+var newlineReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
 // LocalTransform is used to handle a local transform from stdin.
 type LocalTransform struct {
 	Value  string
 	Values map[string]string
 }
 
+// ErrMissingField indicates that a field has not been provided to a local transform.
+var ErrMissingField = errors.New("missing field")
+
+// ValueInt returns the value of the input entity as an integer.
+func (lt LocalTransform) ValueInt() (int, error) {
+	return strconv.Atoi(strings.TrimSpace(lt.Value))
+}
+
+// ValueIP returns the value of the input entity as an IP address, or nil if it is not a valid address.
+func (lt LocalTransform) ValueIP() net.IP {
+	return net.ParseIP(strings.TrimSpace(lt.Value))
+}
+
+// GetInt returns the field with the given key as an integer.
+func (lt LocalTransform) GetInt(key string) (int, error) {
+	v, ok := lt.Values[key]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrMissingField, key)
+	}
+
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return i, nil
+}
+
+// GetBool returns the field with the given key as a boolean, see strconv.ParseBool for the accepted values.
+func (lt LocalTransform) GetBool(key string) (bool, error) {
+	v, ok := lt.Values[key]
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrMissingField, key)
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return b, nil
+}
+
 // ParseLocalArguments parses the arguments supplied on the commandline.
+// The fields are passed as key=value pairs separated by '#'.
+// Only the first '=' that is not escaped as '\=' separates the key from the value,
+// so values may contain further '=' characters and keys can contain escaped ones.
 func ParseLocalArguments(args []string) LocalTransform {
 	if len(args) < 2 {
 		log.Fatal("need at least 2 arguments, got ", len(args), ": ", args)
@@ -43,17 +98,13 @@ func ParseLocalArguments(args []string) LocalTransform {
 		for _, arg := range args[1:] {
 
 			// remove any newlines
-			arg = strings.ReplaceAll(arg, "\n", " ")
+			arg = newlineReplacer.Replace(arg)
 
 			if len(arg) > 0 {
 				vars := strings.Split(arg, "#")
 				for _, x := range vars {
-					kv := strings.Split(x, "=")
-					if len(kv) == 2 {
-						values[kv[0]] = replacer.Replace(kv[1])
-					} else {
-						values[kv[0]] = replacer.Replace(strings.Join(kv[1:], "="))
-					}
+					k, v := splitKeyValue(x)
+					values[k] = v
 				}
 			}
 		}
@@ -64,3 +115,60 @@ func ParseLocalArguments(args []string) LocalTransform {
 		Values: values,
 	}
 }
+
+// splitKeyValue splits a field at the first unescaped '=' and unescapes key and value.
+// If there is no separator, the whole field is used as key with an empty value.
+func splitKeyValue(field string) (key, value string) {
+	for i := 0; i < len(field); i++ {
+		if field[i] == '=' && (i == 0 || field[i-1] != '\\') {
+			return replacer.Replace(field[:i]), replacer.Replace(field[i+1:])
+		}
+	}
+	return replacer.Replace(field), ""
+}
+
+// LocalOutputWarnSize is the size of the output in bytes, above which RunLocal warns that maltego might truncate it.
+// Set to 0 to disable the warning.
+var LocalOutputWarnSize = 4 << 20
+
+// these are variables so that tests can provide arguments and capture the output of RunLocal.
+var (
+	localArgs             = func() []string { return os.Args[1:] }
+	localOutput io.Writer = os.Stdout
+	exit                  = os.Exit
+)
+
+// RunLocal parses the commandline arguments of a local transform and invokes the handler with them.
+// The resulting transform is printed to stdout for maltego.
+// If the handler returns an error, a fatal UI message with the error is printed instead and the program exits.
+func RunLocal(handler func(lt LocalTransform, t *Transform) error) {
+	var (
+		lt = ParseLocalArguments(localArgs())
+		t  = &Transform{}
+	)
+
+	err := handler(lt, t)
+	if err != nil {
+		trx := Transform{}
+		trx.AddUIMessage(err.Error(), UIMessageFatal)
+		fmt.Fprintln(localOutput, trx.ReturnOutput())
+		log.Println("transform failed:", err)
+		exit(0) // don't signal an error for the transform invocation
+		return
+	}
+
+	// the warning precedes the completion message
+	if LocalOutputWarnSize > 0 {
+		if size := t.OutputSize(); size > LocalOutputWarnSize {
+			t.AddUIMessage(outputSizeWarning(size), UIMessagePartialError)
+		}
+	}
+	t.addComplete()
+
+	fmt.Fprintln(localOutput, t.ReturnOutput())
+}
+
+// outputSizeWarning returns the warning for a local transform output of size bytes, which exceeds LocalOutputWarnSize.
+func outputSizeWarning(size int) string {
+	return "output of " + strconv.Itoa(size) + " bytes exceeds " + strconv.Itoa(LocalOutputWarnSize) + " bytes, maltego might drop entities. Consider reducing the results or using a server transform"
+}
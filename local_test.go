@@ -14,12 +14,229 @@
 package maltego
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 )
 
 func TestParseLocalArguments(t *testing.T) {
 	args := []string{"/var/folders/test", "pãypal.com\nxn--pypal-9qa.com\nregistered", "fqdn=pãypal.com\nxn--pypal-9qa.com\nregistered#unicode=pãypal.com#ascii=xn--pypal-9qa.com#status=registered#ips=34.102.136.180#names=180.136.102.34.bc.googleusercontent.com."}
 	lt := ParseLocalArguments(args[1:])
-	fmt.Println(lt.Values)
+
+	if lt.Value != "pãypal.com\nxn--pypal-9qa.com\nregistered" {
+		t.Fatalf("unexpected value %q", lt.Value)
+	}
+
+	for key, expected := range map[string]string{
+		"fqdn":    "pãypal.com xn--pypal-9qa.com registered",
+		"unicode": "pãypal.com",
+		"ascii":   "xn--pypal-9qa.com",
+		"status":  "registered",
+		"ips":     "34.102.136.180",
+		"names":   "180.136.102.34.bc.googleusercontent.com.",
+	} {
+		if v := lt.Values[key]; v != expected {
+			t.Fatalf("unexpected value for %q: %q", key, v)
+		}
+	}
+}
+
+func TestParseLocalArgumentsUnicode(t *testing.T) {
+	lt := ParseLocalArguments([]string{"bücher.example", "unicode=pãypal.com#ascii=xn--pypal-9qa.com#status=registered#name=Zoë &amp; Ünal#emoji=🔍=🌐#日本=東京"})
+
+	for key, expected := range map[string]string{
+		"unicode": "pãypal.com",
+		"ascii":   "xn--pypal-9qa.com",
+		"status":  "registered",
+		"name":    "Zoë & Ünal",
+		"emoji":   "🔍=🌐",
+		"日本":      "東京",
+	} {
+		if v := lt.Values[key]; v != expected {
+			t.Fatalf("unexpected value for %q: %q", key, v)
+		}
+	}
+
+	if lt.Value != "bücher.example" {
+		t.Fatalf("unexpected value %q", lt.Value)
+	}
+}
+
+// fakeLocal provides the arguments for RunLocal and captures its output and exit code until the test is finished.
+func fakeLocal(t *testing.T, args ...string) (*bytes.Buffer, *int) {
+	var (
+		out  bytes.Buffer
+		code = -1
+	)
+
+	localArgs = func() []string { return args }
+	localOutput = &out
+	exit = func(c int) { code = c }
+
+	t.Cleanup(func() {
+		localArgs = func() []string { return os.Args[1:] }
+		localOutput = os.Stdout
+		exit = os.Exit
+	})
+
+	return &out, &code
+}
+
+func TestRunLocal(t *testing.T) {
+	out, code := fakeLocal(t, "example.com", "fqdn=example.com#registrar=Example Inc.")
+
+	RunLocal(func(lt LocalTransform, tr *Transform) error {
+		e := tr.AddEntity("maltego.Phrase", lt.Values["registrar"])
+		e.AddProp("domain", lt.Value)
+		return nil
+	})
+
+	if *code != -1 {
+		t.Fatal("unexpected exit", *code)
+	}
+
+	exp := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities><Entity Type="maltego.Phrase"><Value>Example Inc.</Value><Weight>100</Weight><AdditionalFields><Field MatchingRule="strict" Name="domain" DisplayName="Domain">example.com</Field></AdditionalFields></Entity></Entities><UIMessages><UIMessage MessageType="Inform">complete</UIMessage></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>` + "\n"
+	compare(t, out.Bytes(), exp)
+}
+
+func TestRunLocalError(t *testing.T) {
+	out, code := fakeLocal(t, "example.com", "fqdn=example.com")
+
+	RunLocal(func(lt LocalTransform, t *Transform) error {
+		t.AddEntity("maltego.Phrase", "partial")
+		return errors.New("lookup failed")
+	})
+
+	if *code != 0 {
+		t.Fatal("expected exit code 0, got", *code)
+	}
+
+	exp := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities></Entities><UIMessages><UIMessage MessageType="FatalError">lookup failed</UIMessage></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>` + "\n"
+	compare(t, out.Bytes(), exp)
+}
+
+func TestRunLocalFatalMessage(t *testing.T) {
+	out, _ := fakeLocal(t, "example.com", "fqdn=example.com")
+
+	RunLocal(func(lt LocalTransform, t *Transform) error {
+		t.AddUIMessage("lookup failed", UIMessageFatal)
+		return nil
+	})
+
+	exp := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities></Entities><UIMessages><UIMessage MessageType="FatalError">lookup failed</UIMessage></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>` + "\n"
+	compare(t, out.Bytes(), exp)
+}
+
+func TestLocalTransformConversions(t *testing.T) {
+	lt := ParseLocalArguments([]string{"443", "count=12#verbose=true#ratio=1.5#flag=maybe"})
+
+	if v, err := lt.ValueInt(); err != nil || v != 443 {
+		t.Fatal("unexpected value", v, err)
+	}
+	if i, err := lt.GetInt("count"); err != nil || i != 12 {
+		t.Fatal("unexpected count", i, err)
+	}
+	if b, err := lt.GetBool("verbose"); err != nil || !b {
+		t.Fatal("unexpected verbose", b, err)
+	}
+	if ip := lt.ValueIP(); ip != nil {
+		t.Fatal("unexpected ip", ip)
+	}
+
+	if _, err := lt.GetInt("ratio"); err == nil {
+		t.Fatal("expected error for invalid int")
+	}
+	if _, err := lt.GetInt("missing"); !errors.Is(err, ErrMissingField) {
+		t.Fatal("expected ErrMissingField, got", err)
+	}
+	if _, err := lt.GetBool("flag"); err == nil {
+		t.Fatal("expected error for invalid bool")
+	}
+	if _, err := lt.GetBool("missing"); !errors.Is(err, ErrMissingField) {
+		t.Fatal("expected ErrMissingField, got", err)
+	}
+
+	lt = ParseLocalArguments([]string{"2001:db8::1", ""})
+
+	if ip := lt.ValueIP(); !ip.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatal("unexpected ip", ip)
+	}
+	if _, err := lt.ValueInt(); err == nil {
+		t.Fatal("expected error for invalid int")
+	}
+}
+
+func TestParseLocalArgumentsLineEndings(t *testing.T) {
+	lt := ParseLocalArguments([]string{"example.com", "fqdn=example.com\r\n#whois=line1\r\nline2\rline3\nline4"})
+
+	if v := lt.Values["fqdn"]; v != "example.com " {
+		t.Fatalf("unexpected fqdn %q", v)
+	}
+	if v := lt.Values["whois"]; v != "line1 line2 line3 line4" {
+		t.Fatalf("unexpected whois %q", v)
+	}
+}
+
+func TestParseLocalArgumentsEscapedEquals(t *testing.T) {
+	lt := ParseLocalArguments([]string{"x", `formula=a=b+c#a\=b=c#query=q\=1&amp;r=2#flag#empty=`})
+
+	for key, expected := range map[string]string{
+		"formula": "a=b+c",
+		"a=b":     "c",
+		"query":   "q=1&r=2",
+		"flag":    "",
+		"empty":   "",
+	} {
+		v, ok := lt.Values[key]
+		if !ok {
+			t.Fatalf("missing key %q in %v", key, lt.Values)
+		}
+		if v != expected {
+			t.Fatalf("unexpected value for %q: %q", key, v)
+		}
+	}
+
+	if len(lt.Values) != 5 {
+		t.Fatal("unexpected values", lt.Values)
+	}
+}
+
+func TestRunLocalLargeOutput(t *testing.T) {
+	out, _ := fakeLocal(t, "example.com", "fqdn=example.com")
+
+	defer func(size int) {
+		LocalOutputWarnSize = size
+	}(LocalOutputWarnSize)
+	LocalOutputWarnSize = 1024
+
+	var size int
+	RunLocal(func(lt LocalTransform, t *Transform) error {
+		for i := 0; i < 100; i++ {
+			t.AddEntity("maltego.DNSName", strconv.Itoa(i)+"."+lt.Value)
+		}
+		size = t.OutputSize()
+		if size <= 1024 {
+			return errors.New("output is too small")
+		}
+		return nil
+	})
+
+	if !strings.Contains(out.String(), `<UIMessage MessageType="PartialError">output of `) || !strings.Contains(out.String(), "bytes exceeds 1024 bytes") {
+		t.Fatal("missing warning", out.String())
+	}
+	if strings.Count(out.String(), "<Entity ") != 100 {
+		t.Fatal("entities have been dropped")
+	}
+
+	// the warning reports the size of the handler output and precedes the completion message
+	if !strings.Contains(out.String(), "output of "+strconv.Itoa(size)+" bytes") {
+		t.Fatal("warning does not report the output size", size, out.String())
+	}
+	if strings.Index(out.String(), "exceeds 1024 bytes") > strings.Index(out.String(), ">complete</UIMessage>") {
+		t.Fatal("warning follows the completion message", out.String())
+	}
 }
@@ -0,0 +1,206 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidMachine indicates a syntax error in a maltego machine definition.
+var ErrInvalidMachine = errors.New("invalid machine")
+
+// ValidateMachine performs a lightweight syntax check of the maltego machine definition in src.
+// It ensures that the definition starts with a machine declaration, that all brackets and strings are balanced
+// and that the machine contains a start or onTimer block.
+func ValidateMachine(src string) error {
+	var (
+		stack  []rune
+		line   = 1
+		idents []string
+		ident  strings.Builder
+		runes  = []rune(src)
+	)
+
+	// flush the current identifier
+	flush := func() {
+		if ident.Len() > 0 {
+			idents = append(idents, ident.String())
+			ident.Reset()
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case c == '\n':
+			flush()
+			line++
+		case c == '"':
+			flush()
+			start := line
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				} else if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(runes) {
+				return fmt.Errorf("%w: unterminated string starting on line %d", ErrInvalidMachine, start)
+			}
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			flush()
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			flush()
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end == -1 {
+				return fmt.Errorf("%w: unterminated comment on line %d", ErrInvalidMachine, line)
+			}
+			comment := []rune(string(runes[i+2:])[:end])
+			line += strings.Count(string(comment), "\n")
+			i += len(comment) + 3
+		case c == '(' || c == '{':
+			flush()
+			stack = append(stack, c)
+		case c == ')' || c == '}':
+			flush()
+			open := '('
+			if c == '}' {
+				open = '{'
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				return fmt.Errorf("%w: unexpected %q on line %d", ErrInvalidMachine, c, line)
+			}
+			stack = stack[:len(stack)-1]
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			ident.WriteRune(c)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	if len(stack) > 0 {
+		return fmt.Errorf("%w: unclosed %q", ErrInvalidMachine, stack[len(stack)-1])
+	}
+
+	if len(idents) == 0 || idents[0] != "machine" {
+		return fmt.Errorf("%w: definition must start with a machine declaration", ErrInvalidMachine)
+	}
+
+	for _, id := range idents {
+		if id == "start" || id == "onTimer" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: missing start or onTimer block", ErrInvalidMachine)
+}
+
+// Machine is a builder for maltego machine definitions.
+// Blocks are opened with Start, Paths and Path and closed with End,
+// blocks that are still open when calling String will be closed automatically.
+type Machine struct {
+	Name        string
+	DisplayName string
+	Author      string
+	Description string
+
+	lines []string
+	depth int
+}
+
+// NewMachine creates a new machine builder.
+func NewMachine(name, displayName, author, description string) *Machine {
+	return &Machine{
+		Name:        name,
+		DisplayName: displayName,
+		Author:      author,
+		Description: description,
+	}
+}
+
+// add appends a line at the current depth.
+func (m *Machine) add(line string) *Machine {
+	m.lines = append(m.lines, strings.Repeat("    ", m.depth+1)+line)
+	return m
+}
+
+// open starts a new block with the given keyword.
+func (m *Machine) open(keyword string) *Machine {
+	m.add(keyword + " {")
+	m.depth++
+	return m
+}
+
+// Start opens the start block, which is executed when the machine is run.
+func (m *Machine) Start() *Machine {
+	return m.open("start")
+}
+
+// Paths opens a paths block, the contained paths are executed in parallel.
+func (m *Machine) Paths() *Machine {
+	return m.open("paths")
+}
+
+// Path opens a path block, the contained transforms are executed in sequence.
+func (m *Machine) Path() *Machine {
+	return m.open("path")
+}
+
+// RunTransform runs the transform with the given name.
+func (m *Machine) RunTransform(name string) *Machine {
+	return m.add("run(" + strconv.Quote(name) + ")")
+}
+
+// End closes the current block.
+func (m *Machine) End() *Machine {
+	if m.depth > 0 {
+		m.depth--
+		m.add("}")
+	}
+	return m
+}
+
+// String returns the machine definition.
+func (m *Machine) String() string {
+	var b strings.Builder
+
+	b.WriteString("machine(" + strconv.Quote(m.Name) + ",\n")
+	b.WriteString("        displayName: " + strconv.Quote(m.DisplayName) + ",\n")
+	b.WriteString("        author: " + strconv.Quote(m.Author) + ",\n")
+	b.WriteString("        description: " + strconv.Quote(m.Description) + ") {\n")
+
+	for _, l := range m.lines {
+		b.WriteString(l + "\n")
+	}
+
+	// close open blocks
+	for d := m.depth; d > 0; d-- {
+		b.WriteString(strings.Repeat("    ", d) + "}\n")
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
@@ -0,0 +1,92 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateMachine(t *testing.T) {
+	valid := `// Footprint machine
+machine("test.Footprint",
+        displayName: "Footprint {L1}",
+        author: "Test",
+        description: "Runs a simple footprint") {
+
+    /* start with the domain */
+    start {
+        run("paterva.v2.DomainToDNSName_DNS")
+        paths {
+            run("paterva.v2.DNSNameToIPAddress_DNS")
+            run("paterva.v2.IPAddressToNetblock_Cuts")
+        }
+    }
+}`
+
+	if err := ValidateMachine(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	unbalanced := `machine("test.Footprint") {
+    start {
+        run("paterva.v2.DomainToDNSName_DNS")
+}`
+
+	if err := ValidateMachine(unbalanced); !errors.Is(err, ErrInvalidMachine) {
+		t.Fatal("expected invalid machine error, got", err)
+	}
+
+	if err := ValidateMachine(`start { run("test.ToTest") }`); !errors.Is(err, ErrInvalidMachine) {
+		t.Fatal("expected invalid machine error for missing declaration, got", err)
+	}
+}
+
+func TestMachineBuilder(t *testing.T) {
+	expected := `machine("test.Footprint",
+        displayName: "Footprint",
+        author: "Test",
+        description: "Resolves a domain") {
+    start {
+        run("paterva.v2.DomainToDNSName_DNS")
+        run("paterva.v2.DNSNameToIPAddress_DNS")
+    }
+}
+`
+
+	m := NewMachine("test.Footprint", "Footprint", "Test", "Resolves a domain").
+		Start().
+		RunTransform("paterva.v2.DomainToDNSName_DNS").
+		RunTransform("paterva.v2.DNSNameToIPAddress_DNS").
+		End()
+
+	if m.String() != expected {
+		t.Fatal("unexpected machine definition:\n" + m.String())
+	}
+
+	if err := ValidateMachine(m.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// open blocks are closed automatically
+	m = NewMachine("test.Parallel", "Parallel", "Test", "Runs paths in parallel").
+		Start().
+		Paths().
+		Path().RunTransform("test.ToA").End().
+		Path().RunTransform("test.ToB")
+
+	if err := ValidateMachine(m.String()); err != nil {
+		t.Fatal(err, m.String())
+	}
+}
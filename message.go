@@ -13,7 +13,11 @@
 
 package maltego
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+)
 
 // RequestMessage models a request.
 type RequestMessage struct {
@@ -39,3 +43,93 @@ type TransformField struct {
 	Text string `xml:",chardata"`
 	Name string `xml:"Name,attr"`
 }
+
+// NewRequest creates a transform with an empty request message,
+// which can be populated and serialized with ReturnRequestOutput to invoke a transform on another server.
+func NewRequest() *Transform {
+	return &Transform{
+		RequestMessage: &RequestMessage{},
+	}
+}
+
+// AddEntity adds an input entity with weight 0 to the request.
+func (m *RequestMessage) AddEntity(typ, value string) *Entity {
+	ent := NewEntity(typ, value, "0")
+	m.Entities.Items = append(m.Entities.Items, ent)
+	return ent
+}
+
+// SetLimits sets the soft and hard limit for the number of entities returned by the transform.
+func (m *RequestMessage) SetLimits(soft, hard int) {
+	m.Limits.SoftLimit = strconv.Itoa(soft)
+	m.Limits.HardLimit = strconv.Itoa(hard)
+}
+
+// AddTransformField adds a transform field with the given name and value to the request.
+func (m *RequestMessage) AddTransformField(name, value string) {
+	m.TransformFields.Fields = append(m.TransformFields.Fields, &TransformField{
+		Name: name,
+		Text: value,
+	})
+}
+
+// ErrNoResponse indicates a message that contains neither a response nor exceptions.
+var ErrNoResponse = errors.New("no response or exception message")
+
+// ParseResponse parses a response message returned by a transform server,
+// including the fields and display information of the returned entities.
+// If the transform failed, the returned transform contains the exceptions instead of a response.
+func ParseResponse(data []byte) (*Transform, error) {
+	tr := &Transform{}
+
+	err := xml.Unmarshal(data, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	if tr.ResponseMessage == nil && tr.ExceptionMessage == nil {
+		return nil, ErrNoResponse
+	}
+
+	return tr, nil
+}
+
+// MessageKind is the kind of message contained in a Transform.
+type MessageKind int
+
+// message kinds
+const (
+	MessageKindUnknown MessageKind = iota
+	MessageKindRequest
+	MessageKindResponse
+	MessageKindException
+)
+
+// String returns the name of the message kind.
+func (k MessageKind) String() string {
+	switch k {
+	case MessageKindRequest:
+		return "Request"
+	case MessageKindResponse:
+		return "Response"
+	case MessageKindException:
+		return "Exception"
+	default:
+		return "Unknown"
+	}
+}
+
+// Kind returns the kind of message contained in the transform.
+// Exceptions take precedence over a response, a response takes precedence over a request.
+func (tr *Transform) Kind() MessageKind {
+	switch {
+	case tr.ExceptionMessage != nil:
+		return MessageKindException
+	case tr.ResponseMessage != nil:
+		return MessageKindResponse
+	case tr.RequestMessage != nil:
+		return MessageKindRequest
+	default:
+		return MessageKindUnknown
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// MetricsRecorder receives metrics about the requests handled by a transform.
+type MetricsRecorder interface {
+
+	// Record is called once for every request to the transform with the given name,
+	// with the time it took to handle the request, whether an exception was produced
+	// and the number of entities that were returned.
+	Record(name string, duration time.Duration, exception bool, entities int)
+}
+
+// WithMetrics wraps the handler and records metrics for every request it handles.
+// The number of entities and exceptions are reported by the handlers of this package through the request context,
+// a request is considered to have produced an exception if the response contains exceptions
+// or has been answered with an HTTP error status.
+func WithMetrics(next http.HandlerFunc, name string, rec MetricsRecorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+
+		m := &requestMetrics{}
+		mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+		next(mw, r.WithContext(context.WithValue(r.Context(), metricsKey{}, m)))
+
+		rec.Record(name, time.Since(start), m.exception || mw.status >= http.StatusBadRequest, m.entities)
+	}
+}
+
+// metricsKey is the context key for the requestMetrics of a request.
+type metricsKey struct{}
+
+// requestMetrics holds the results reported by the handler for a request measured by WithMetrics.
+type requestMetrics struct {
+	exception bool
+	entities  int
+}
+
+// recordTransform reports the number of entities and whether exceptions have been added to the transform
+// to WithMetrics. It must be called before the transform is serialized.
+func recordTransform(r *http.Request, t *Transform) {
+	m, ok := r.Context().Value(metricsKey{}).(*requestMetrics)
+	if !ok {
+		return
+	}
+	if t.ExceptionMessage != nil && len(t.ExceptionMessage.Exceptions.Items) > 0 {
+		m.exception = true
+	}
+	if t.ResponseMessage != nil {
+		m.entities = len(t.ResponseMessage.Entities.Items)
+	}
+}
+
+// recordException reports to WithMetrics that an exception has been sent back for the request.
+func recordException(r *http.Request) {
+	if m, ok := r.Context().Value(metricsKey{}).(*requestMetrics); ok {
+		m.exception = true
+		m.entities = 0
+	}
+}
+
+// metricsWriter keeps a copy of the status written to the wrapped http.ResponseWriter.
+type metricsWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *metricsWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
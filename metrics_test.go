@@ -0,0 +1,94 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMetricsRecorder struct {
+	name      string
+	duration  time.Duration
+	exception bool
+	entities  int
+	calls     int
+}
+
+func (r *testMetricsRecorder) Record(name string, duration time.Duration, exception bool, entities int) {
+	r.name = name
+	r.duration = duration
+	r.exception = exception
+	r.entities = entities
+	r.calls++
+}
+
+func TestWithMetrics(t *testing.T) {
+	rec := &testMetricsRecorder{}
+
+	h := WithMetrics(MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		t.AddEntity("maltego.IPv4Address", "93.184.216.35")
+		return nil
+	}), "toIP", rec)
+
+	serveTestRequest(h, testRequest)
+
+	if rec.calls != 1 || rec.name != "toIP" || rec.exception || rec.entities != 2 || rec.duration <= 0 {
+		t.Fatalf("unexpected metrics: %+v", rec)
+	}
+}
+
+func TestWithMetricsException(t *testing.T) {
+	rec := &testMetricsRecorder{}
+
+	h := WithMetrics(MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		return errors.New("lookup failed")
+	}), "toIP", rec)
+
+	serveTestRequest(h, testRequest)
+
+	if rec.calls != 1 || !rec.exception || rec.entities != 0 {
+		t.Fatalf("unexpected metrics: %+v", rec)
+	}
+
+	// malformed requests are answered with an error status
+	serveTestRequest(h, "<MaltegoMessage></MaltegoMessage>")
+
+	if rec.calls != 2 || !rec.exception {
+		t.Fatalf("unexpected metrics: %+v", rec)
+	}
+}
+
+func TestWithMetricsGzip(t *testing.T) {
+	rec := &testMetricsRecorder{}
+
+	h := WithMetrics(MakeHandler(func(w http.ResponseWriter, r *http.Request, t *Transform) {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		t.AddException("partial result", "")
+	}), "toIP", rec)
+
+	req := httptest.NewRequest(http.MethodPost, "/run/toIP", strings.NewReader(testRequest))
+	req.Header.Set("Accept-Encoding", "gzip")
+	h(httptest.NewRecorder(), req)
+
+	if rec.calls != 1 || !rec.exception || rec.entities != 1 {
+		t.Fatalf("unexpected metrics: %+v", rec)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"sync"
+)
+
+// RunParallel runs the tasks with at most maxConc tasks at the same time and adds the returned entities to the response.
+// If maxConc is not positive, all tasks are started at once.
+// Entities are added in the order of the tasks, tasks may return a nil entity to add nothing.
+// Task errors do not abort the other tasks, they are reported to the user as partial errors.
+// Once ctx is done, no further tasks are started and the error of the context is returned.
+func (tr *Transform) RunParallel(ctx context.Context, tasks []func() (*Entity, error), maxConc int) error {
+	if maxConc <= 0 || maxConc > len(tasks) {
+		maxConc = len(tasks)
+	}
+
+	type result struct {
+		entity *Entity
+		err    error
+	}
+
+	var (
+		results = make([]result, len(tasks))
+		sem     = make(chan struct{}, maxConc)
+		wg      sync.WaitGroup
+		err     error
+	)
+
+loop:
+	for i, task := range tasks {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		case sem <- struct{}{}:
+		}
+
+		// check again, select chooses randomly if both cases are ready
+		if ctx.Err() != nil {
+			<-sem
+			err = ctx.Err()
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, task func() (*Entity, error)) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			e, errTask := task()
+			results[i] = result{entity: e, err: errTask}
+		}(i, task)
+	}
+
+	wg.Wait()
+
+	for _, r := range results {
+		if r.err != nil {
+			tr.AddUIMessage(r.err.Error(), UIMessagePartialError)
+			continue
+		}
+		if r.entity != nil {
+			tr.addEntity(r.entity)
+		}
+	}
+
+	return err
+}
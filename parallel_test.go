@@ -0,0 +1,132 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransformRunParallel(t *testing.T) {
+	var (
+		trx     = &Transform{}
+		tasks   []func() (*Entity, error)
+		running int32
+		maxSeen int32
+	)
+
+	for i := 0; i < 100; i++ {
+		i := i
+		tasks = append(tasks, func() (*Entity, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				m := atomic.LoadInt32(&maxSeen)
+				if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			if i%10 == 0 {
+				return nil, errors.New("lookup " + strconv.Itoa(i) + " failed")
+			}
+			return NewEntity("maltego.IPv4Address", "10.0.0."+strconv.Itoa(i), "100"), nil
+		})
+	}
+
+	if err := trx.RunParallel(context.Background(), tasks, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if maxSeen > 4 {
+		t.Fatal("concurrency limit exceeded:", maxSeen)
+	}
+
+	items := trx.ResponseMessage.Entities.Items
+	if len(items) != 90 {
+		t.Fatal("expected 90 entities, got", len(items))
+	}
+	if items[0].Value != "10.0.0.1" || items[89].Value != "10.0.0.99" {
+		t.Fatal("entities are not in task order", items[0].Value, items[89].Value)
+	}
+
+	messages := trx.ResponseMessage.UIMessages.Items
+	if len(messages) != 10 || messages[0].Text != "lookup 0 failed" || messages[0].MessageType != UIMessagePartialError {
+		t.Fatal("unexpected messages", len(messages))
+	}
+}
+
+func TestTransformRunParallelCanceled(t *testing.T) {
+	var (
+		trx         = &Transform{}
+		ctx, cancel = context.WithCancel(context.Background())
+		tasks       []func() (*Entity, error)
+		started     int32
+	)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		tasks = append(tasks, func() (*Entity, error) {
+			if atomic.AddInt32(&started, 1) == 2 {
+				cancel()
+			}
+			return NewEntity("maltego.Phrase", "result", "100"), nil
+		})
+	}
+
+	if err := trx.RunParallel(ctx, tasks, 1); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	if started == 10 {
+		t.Fatal("tasks have been started after cancellation")
+	}
+}
+
+func TestTransformConcurrentSafe(t *testing.T) {
+	trx := &Transform{}
+	trx.EnableConcurrentSafe()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				trx.AddEntity("maltego.Phrase", strconv.Itoa(g)+"-"+strconv.Itoa(i))
+				trx.AddUIMessage("added", UIMessageDebug)
+				if i%50 == 0 {
+					trx.AddException("oops", "")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := len(trx.ResponseMessage.Entities.Items); n != 800 {
+		t.Fatal("expected 800 entities, got", n)
+	}
+	if n := len(trx.ResponseMessage.UIMessages.Items); n != 800 {
+		t.Fatal("expected 800 messages, got", n)
+	}
+	if n := len(trx.ExceptionMessage.Exceptions.Items); n != 16 {
+		t.Fatal("expected 16 exceptions, got", n)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import "sync"
+
+// UseTransformPool configures whether the handlers created by MakeHandler and the related functions
+// get their transforms from GetTransform and return them with PutTransform once the response has been written.
+// When enabled, handlers must not keep any references to the transform or its messages and entities after returning.
+var UseTransformPool = false
+
+var transformPool = sync.Pool{
+	New: func() interface{} {
+		return &Transform{}
+	},
+}
+
+// GetTransform returns an empty transform from the pool, which should be returned with PutTransform when it is no longer used.
+func GetTransform() *Transform {
+	return transformPool.Get().(*Transform)
+}
+
+// PutTransform resets the transform and returns it to the pool.
+// The transform is reset to its zero value, but the response message and its slices are kept for reuse.
+// Neither the transform nor its messages and entities may be used after calling PutTransform.
+func PutTransform(tr *Transform) {
+	tr.reset()
+	transformPool.Put(tr)
+}
+
+// reset sets the transform to its zero value and keeps the cleared response message for reuse.
+func (tr *Transform) reset() {
+	resp := tr.ResponseMessage
+	if resp == nil {
+		resp = tr.spare
+	}
+
+	*tr = Transform{}
+
+	if resp != nil {
+		items := resp.Entities.Items
+		for i := range items {
+			items[i] = nil
+		}
+
+		messages := resp.UIMessages.Items
+		for i := range messages {
+			messages[i] = nil
+		}
+
+		resp.Entities.Items = items[:0]
+		resp.UIMessages.Items = messages[:0]
+		tr.spare = resp
+	}
+}
+
+// newResponse returns the response message kept for reuse, or a new one.
+func (tr *Transform) newResponse() *ResponseMessage {
+	if r := tr.spare; r != nil {
+		tr.spare = nil
+		return r
+	}
+	return &ResponseMessage{}
+}
+
+// newTransform returns a transform for handling a request, from the pool if UseTransformPool is enabled.
+func newTransform() *Transform {
+	if UseTransformPool {
+		return GetTransform()
+	}
+	return &Transform{}
+}
+
+// releaseTransform returns the transform to the pool if UseTransformPool is enabled.
+func releaseTransform(tr *Transform) {
+	if UseTransformPool {
+		PutTransform(tr)
+	}
+}
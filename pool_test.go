@@ -0,0 +1,109 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTransformReset(t *testing.T) {
+	trx := &Transform{}
+	trx.SetDeduplicate(true)
+	trx.AddEntity("maltego.Domain", "example.com")
+	trx.AddUIMessage("done", UIMessageInform)
+	trx.AddException("oops", "")
+	trx.AddTransformField("key", "value")
+
+	trx.reset()
+
+	// the reset transform is empty and serializes like a new one
+	if trx.ResponseMessage != nil || trx.ExceptionMessage != nil || trx.RequestMessage != nil || trx.dedup || trx.seen != nil {
+		t.Fatalf("transform has not been reset: %+v", trx)
+	}
+	compare(t, []byte(trx.ReturnOutput()), (&Transform{}).ReturnOutput())
+
+	// the response message is reused without the previous contents
+	trx.AddEntity("maltego.Domain", "example.org")
+	if items := trx.ResponseMessage.Entities.Items; len(items) != 1 || items[0].Value != "example.org" {
+		t.Fatal("unexpected entities", items)
+	}
+	if len(trx.ResponseMessage.UIMessages.Items) != 0 {
+		t.Fatal("unexpected messages", trx.ResponseMessage.UIMessages.Items)
+	}
+}
+
+func TestMakeHandlerTransformPool(t *testing.T) {
+	UseTransformPool = true
+	t.Cleanup(func() {
+		UseTransformPool = false
+	})
+
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", t.RequestMessage.Entities.Items[0].Value)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				rec := httptest.NewRecorder()
+				h(rec, httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest)))
+
+				exp := `<MaltegoTransformResponseMessage><Entities><Entity Type="maltego.IPv4Address"><Value>example.com</Value><Weight>100</Weight></Entity></Entities><UIMessages><UIMessage MessageType="Inform">complete</UIMessage></UIMessages></MaltegoTransformResponseMessage>`
+				if !strings.Contains(rec.Body.String(), exp) {
+					t.Error("unexpected response", rec.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkHandlerTransformPool compares the allocations per request with and without UseTransformPool.
+func BenchmarkHandlerTransformPool(b *testing.B) {
+	h := MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		for i := 0; i < 32; i++ {
+			t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		}
+		return nil
+	})
+
+	for _, pool := range []bool{false, true} {
+		name := "new"
+		if pool {
+			name = "pool"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			UseTransformPool = pool
+			defer func() {
+				UseTransformPool = false
+			}()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/run/test", strings.NewReader(testRequest)))
+			}
+		})
+	}
+}
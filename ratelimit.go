@@ -0,0 +1,87 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithRateLimit wraps the handler and limits the requests to rps per second, with bursts of up to burst requests.
+// Throttled requests are answered with an exception that asks the user to retry later and a Retry-After header.
+// Like for WithAuth, the exception is sent with status 200, since maltego only displays the exception messages of successful responses.
+// WithRateLimit panics if rps is not positive or burst is less than one, since the bucket would then never refill or never hold a token.
+func WithRateLimit(next http.HandlerFunc, rps float64, burst int) http.HandlerFunc {
+	if rps <= 0 || burst < 1 {
+		panic(fmt.Sprintf("maltego: WithRateLimit requires rps > 0 and burst >= 1, got rps=%v and burst=%d", rps, burst))
+	}
+
+	b := newTokenBucket(rps, burst)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, wait := b.take(time.Now())
+		if !ok {
+			logger.Log("rate limit exceeded", "remote", r.RemoteAddr, "transform", transformName(r))
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			recordException(r)
+			w.Write([]byte(exceptionOutput("rate limit exceeded, please retry in " + wait.Round(time.Millisecond).String())))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// tokenBucket is a token bucket that is refilled with rate tokens per second, up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full token bucket.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// take removes a token from the bucket if there is one available at the given time.
+// Otherwise the duration until the next token is available is returned.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,102 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	h := WithRateLimit(MakeHandlerCtx(func(ctx context.Context, t *Transform) error {
+		t.AddEntity("maltego.IPv4Address", "93.184.216.34")
+		return nil
+	}), 1, 2)
+
+	var passed, throttled int
+	for i := 0; i < 5; i++ {
+		rec := serveTestRequest(h, testRequest)
+
+		if rec.Code != http.StatusOK {
+			t.Fatal("unexpected status", rec.Code)
+		}
+
+		if !strings.Contains(rec.Body.String(), `<Exception code="">rate limit exceeded, please retry in `) {
+			passed++
+			continue
+		}
+
+		throttled++
+		if rec.Header().Get("Retry-After") != "1" {
+			t.Fatal("unexpected Retry-After", rec.Header().Get("Retry-After"))
+		}
+	}
+
+	if passed != 2 || throttled != 3 {
+		t.Fatal("expected 2 passed and 3 throttled requests, got", passed, throttled)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var (
+		b   = newTokenBucket(2, 1)
+		now = time.Now()
+	)
+
+	if ok, _ := b.take(now); !ok {
+		t.Fatal("expected token")
+	}
+	ok, wait := b.take(now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatal("expected to wait 500ms, got", ok, wait)
+	}
+
+	// refilled after the wait
+	if ok, _ = b.take(now.Add(wait)); !ok {
+		t.Fatal("expected token after refill")
+	}
+
+	// never exceeds the burst
+	b.take(now.Add(time.Hour))
+	if ok, _ = b.take(now.Add(time.Hour)); ok {
+		t.Fatal("bucket exceeded burst")
+	}
+}
+
+func TestWithRateLimitInvalidArguments(t *testing.T) {
+	for _, c := range []struct {
+		rps   float64
+		burst int
+	}{
+		{0, 1},
+		{-1, 1},
+		{1, 0},
+	} {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("expected panic for", c.rps, c.burst)
+				}
+				if !strings.Contains(r.(string), "WithRateLimit requires rps > 0 and burst >= 1") {
+					t.Fatal("unexpected panic", r)
+				}
+			}()
+			WithRateLimit(func(w http.ResponseWriter, r *http.Request) {}, c.rps, c.burst)
+		}()
+	}
+}
@@ -15,15 +15,85 @@ package maltego
 
 import (
 	"encoding/xml"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// marshal serializes the transform messages, it is a variable so that tests can simulate failures.
+var marshal = encodeTransform
+
 // Transform models a maltego transformation message.
 type Transform struct {
 	XMLName          xml.Name          `xml:"MaltegoMessage"`
 	ResponseMessage  *ResponseMessage  `xml:"MaltegoTransformResponseMessage,omitempty"`
 	ExceptionMessage *ExceptionMessage `xml:"MaltegoTransformExceptionMessage"`
 	RequestMessage   *RequestMessage   `xml:"MaltegoTransformRequestMessage,omitempty"`
+
+	// deduplicate entities by type and value
+	dedup bool
+
+	// entities in the response by type and value, used for deduplication
+	seen map[entityKey]*Entity
+
+	// collapse identical UI messages
+	dedupMessages bool
+
+	// UI messages in the response by text and type, used for deduplication
+	messages map[uiMessageKey]*uiMessageCount
+
+	// guards the messages if concurrent use has been enabled
+	mu *sync.Mutex
+
+	// response message kept for reuse by PutTransform
+	spare *ResponseMessage
+
+	// do not add the complete message when the handler returns
+	suppressComplete bool
+}
+
+// EnableConcurrentSafe makes AddEntity, AddUIMessage, AddUIMessageTyped and AddException safe for concurrent use.
+// It must be called before the transform is shared between goroutines.
+// Other methods, as well as modifying the returned entities, still require synchronization by the caller.
+func (tr *Transform) EnableConcurrentSafe() {
+	if tr.mu == nil {
+		tr.mu = &sync.Mutex{}
+	}
+}
+
+// lock locks the transform if concurrent use has been enabled.
+func (tr *Transform) lock() {
+	if tr.mu != nil {
+		tr.mu.Lock()
+	}
+}
+
+// unlock unlocks the transform if concurrent use has been enabled.
+func (tr *Transform) unlock() {
+	if tr.mu != nil {
+		tr.mu.Unlock()
+	}
+}
+
+// uiMessageKey identifies a UI message by its original text and type.
+type uiMessageKey struct {
+	text string
+	typ  string
+}
+
+// uiMessageCount counts the occurrences of a UI message.
+type uiMessageCount struct {
+	msg   *UIMessage
+	count int
+}
+
+// entityKey identifies an entity by type and value.
+type entityKey struct {
+	typ   string
+	value string
 }
 
 // ResponseMessage models a maltego response message.
@@ -65,36 +135,243 @@ type Exception struct {
 }
 
 // AddEntity adds an entity to the transform.
+// If deduplication is enabled and an entity with the same type and value exists, the existing entity is returned.
 func (tr *Transform) AddEntity(typ, value string) *Entity {
+	return tr.addEntity(NewEntity(typ, EscapeText(value), "100"))
+}
+
+// AddEntityWithFields adds an entity to the transform like AddEntity and adds the fields to it with AddProp.
+// The fields are added sorted by name, so the output does not depend on the iteration order of the map.
+func (tr *Transform) AddEntityWithFields(typ, value string, fields map[string]string) *Entity {
+	e := tr.AddEntity(typ, value)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		e.AddProp(name, fields[name])
+	}
+
+	return e
+}
+
+// addEntity adds ent to the response, or returns the existing entity with the same type and value if deduplication is enabled.
+func (tr *Transform) addEntity(ent *Entity) *Entity {
+	tr.lock()
+	defer tr.unlock()
 
 	// ensure response message is initialized
 	if tr.ResponseMessage == nil {
-		tr.ResponseMessage = &ResponseMessage{}
+		tr.ResponseMessage = tr.newResponse()
+	}
+
+	if tr.dedup {
+		if tr.seen == nil {
+			tr.seen = make(map[entityKey]*Entity)
+			for _, e := range tr.ResponseMessage.Entities.Items {
+				if _, ok := tr.seen[entityKey{e.Type, e.Value}]; !ok {
+					tr.seen[entityKey{e.Type, e.Value}] = e
+				}
+			}
+		}
+
+		key := entityKey{ent.Type, ent.Value}
+		if existing, ok := tr.seen[key]; ok {
+			return existing
+		}
+		tr.seen[key] = ent
 	}
 
-	ent := NewEntity(typ, EscapeText(value), "100")
 	tr.ResponseMessage.Entities.Items = append(tr.ResponseMessage.Entities.Items, ent)
 
 	return ent
 }
 
+// SetDeduplicate configures whether AddEntity skips entities with a type and value that has already been added.
+// In that case the existing entity is returned, so properties can still be added to it.
+func (tr *Transform) SetDeduplicate(dedup bool) {
+	tr.dedup = dedup
+	tr.seen = nil
+}
+
+// SortByWeight sorts the entities of the response descending by their weight.
+// Entities with an empty or invalid weight are treated as having weight 0, the order of equal weights is preserved.
+func (tr *Transform) SortByWeight() {
+	if tr.ResponseMessage == nil {
+		return
+	}
+
+	items := tr.ResponseMessage.Entities.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return entityWeight(items[i]) > entityWeight(items[j])
+	})
+}
+
+// Truncate keeps only the first n entities of the response and informs the user how many were dropped.
+// If n is larger than the number of entities, nothing happens.
+func (tr *Transform) Truncate(n int) {
+	if tr.ResponseMessage == nil {
+		return
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	items := tr.ResponseMessage.Entities.Items
+	if n >= len(items) {
+		return
+	}
+
+	// release the dropped entities
+	for i := n; i < len(items); i++ {
+		items[i] = nil
+	}
+	tr.ResponseMessage.Entities.Items = items[:n]
+	tr.seen = nil
+
+	tr.AddUIMessage("dropped "+strconv.Itoa(len(items)-n)+" of "+strconv.Itoa(len(items))+" entities", UIMessageInform)
+}
+
+// entityWeight returns the numeric weight of e, or 0 if it can not be parsed.
+func entityWeight(e *Entity) float64 {
+	w, err := strconv.ParseFloat(strings.TrimSpace(e.Weight), 64)
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+// CopyRequestFieldsTo copies the fields with the given names from the first request entity onto e.
+// If no names are provided, all fields are copied.
+func (tr *Transform) CopyRequestFieldsTo(e *Entity, names ...string) {
+	if tr.RequestMessage == nil || len(tr.RequestMessage.Entities.Items) == 0 {
+		return
+	}
+
+	req := tr.RequestMessage.Entities.Items[0]
+	if req.Fields == nil {
+		return
+	}
+
+	for _, f := range req.Fields.Items {
+		if len(names) > 0 && !contains(names, f.Name) {
+			continue
+		}
+		e.SetProperty(f.Name, f.DisplayName, f.MatchingRule, f.Text)
+	}
+}
+
+// contains reports whether s is contained in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // AddUIMessage adds a UI message to the transform.
 func (tr *Transform) AddUIMessage(message, messageType string) {
+	tr.lock()
+	defer tr.unlock()
 
 	// ensure response message is initialized
 	if tr.ResponseMessage == nil {
-		tr.ResponseMessage = &ResponseMessage{}
+		tr.ResponseMessage = tr.newResponse()
 	}
 
-	// add UIMessage
-	tr.ResponseMessage.UIMessages.Items = append(tr.ResponseMessage.UIMessages.Items, &UIMessage{
+	msg := &UIMessage{
 		Text:        message,
 		MessageType: messageType,
-	})
+	}
+
+	if tr.dedupMessages {
+		if tr.messages == nil {
+			tr.messages = make(map[uiMessageKey]*uiMessageCount)
+			for _, m := range tr.ResponseMessage.UIMessages.Items {
+				if _, ok := tr.messages[uiMessageKey{m.Text, m.MessageType}]; !ok {
+					tr.messages[uiMessageKey{m.Text, m.MessageType}] = &uiMessageCount{msg: m, count: 1}
+				}
+			}
+		}
+
+		key := uiMessageKey{message, messageType}
+		if existing, ok := tr.messages[key]; ok {
+			existing.count++
+			existing.msg.Text = message + " (x" + strconv.Itoa(existing.count) + ")"
+			return
+		}
+		tr.messages[key] = &uiMessageCount{msg: msg, count: 1}
+	}
+
+	// add UIMessage
+	tr.ResponseMessage.UIMessages.Items = append(tr.ResponseMessage.UIMessages.Items, msg)
+}
+
+// SetDeduplicateUIMessages configures whether AddUIMessage collapses messages with the same text and type.
+// Instead of adding a duplicate, the number of occurrences is appended to the existing message, e.g. "timeout (x3)".
+func (tr *Transform) SetDeduplicateUIMessages(dedup bool) {
+	tr.dedupMessages = dedup
+	tr.messages = nil
+}
+
+// AddUIMessageTyped adds a UI message with the given type to the transform.
+// Invalid types are ignored, because maltego would not display the message.
+func (tr *Transform) AddUIMessageTyped(text string, t UIMessageType) {
+	if !t.Valid() {
+		fmt.Println("invalid UI message type:", t)
+		return
+	}
+
+	tr.AddUIMessage(text, string(t))
+}
+
+// SuppressComplete disables the informational "complete" message,
+// that MakeHandler and RunLocal add to the transform after the handler returned.
+// Use this for transforms that report their own final status.
+func (tr *Transform) SuppressComplete() {
+	tr.suppressComplete = true
+}
+
+// addComplete adds the informational "complete" message to the transform,
+// unless it has been suppressed or the transform contains an exception or a fatal error message, which would contradict it.
+func (tr *Transform) addComplete() {
+	if tr.suppressComplete || tr.failed() {
+		return
+	}
+
+	tr.AddUIMessage("complete", UIMessageInform)
+}
+
+// failed reports whether the transform contains an exception or a fatal error message.
+func (tr *Transform) failed() bool {
+	tr.lock()
+	defer tr.unlock()
+
+	if tr.ExceptionMessage != nil && len(tr.ExceptionMessage.Exceptions.Items) > 0 {
+		return true
+	}
+
+	if tr.ResponseMessage != nil {
+		for _, m := range tr.ResponseMessage.UIMessages.Items {
+			if m.MessageType == UIMessageFatal {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 // AddException adds an exception to the transform.
 func (tr *Transform) AddException(exceptionString, code string) {
+	tr.lock()
+	defer tr.unlock()
 
 	// ensure response message is initialized
 	if tr.ExceptionMessage == nil {
@@ -108,12 +385,25 @@ func (tr *Transform) AddException(exceptionString, code string) {
 	})
 }
 
+// AddTransformField adds a transform field to the request of the transform.
+func (tr *Transform) AddTransformField(name, value string) {
+
+	// ensure request message is initialized
+	if tr.RequestMessage == nil {
+		tr.RequestMessage = &RequestMessage{}
+	}
+
+	tr.RequestMessage.AddTransformField(name, value)
+}
+
 // DisplayInformation models maltego display information.
 type DisplayInformation struct {
 	Labels []*DisplayLabel `xml:"Label"`
 }
 
 // DisplayLabel models a label for display information.
+// Maltego renders each label as a section in the detail view of an entity,
+// Name is the title of the section and Text its HTML content.
 type DisplayLabel struct {
 	XMLName xml.Name `xml:"Label"`
 	Text    string   `xml:",cdata"`
@@ -121,18 +411,62 @@ type DisplayLabel struct {
 	Type    string   `xml:"Type,attr"`
 }
 
-func NewDisplayLabel(text string, name string) *DisplayLabel {
+// NewDisplayLabel creates a label with the HTML content and the section title.
+// Note the order of the arguments: the content comes first, prefer NewHTMLDisplayLabel for new code.
+func NewDisplayLabel(content string, title string) *DisplayLabel {
 	return &DisplayLabel{
-		Text: text,
-		Name: name,
+		Text: content,
+		Name: title,
 		Type: "text/html",
 	}
 }
 
+// NewHTMLDisplayLabel creates a label for a section with the given title and HTML content.
+func NewHTMLDisplayLabel(title string, html string) *DisplayLabel {
+	return NewDisplayLabel(html, title)
+}
+
 // ReturnOutput returns the transformations XML representation.
+// Errors are logged, in that case an empty string is returned, use ReturnOutputE to handle them.
 func (tr *Transform) ReturnOutput() string {
 
-	data, err := xml.Marshal(tr)
+	out, err := tr.ReturnOutputE()
+	if err != nil {
+		log.Println("failed to marshal transform: ", err)
+	}
+
+	return out
+}
+
+// ReturnOutputE returns the transformations XML representation, or an error if it could not be marshaled.
+func (tr *Transform) ReturnOutputE() (string, error) {
+
+	return marshal(tr)
+}
+
+// OutputSize returns the size of the transformations XML representation in bytes.
+func (tr *Transform) OutputSize() int {
+	return len(tr.ReturnOutput())
+}
+
+// ReturnOutputWithHeader returns the transformations XML representation prefixed with the XML declaration,
+// which is expected by some versions of the maltego client.
+func (tr *Transform) ReturnOutputWithHeader() string {
+
+	out := tr.ReturnOutput()
+	if out == "" {
+		return ""
+	}
+
+	return xml.Header + out
+}
+
+// ReturnOutputIndent returns the transformations XML representation,
+// with each element on a new line that starts with prefix and is indented by indent per level of nesting.
+// This is useful for debugging, ReturnOutput should be preferred for sending the response to maltego.
+func (tr *Transform) ReturnOutputIndent(prefix, indent string) string {
+
+	data, err := xml.MarshalIndent(tr, prefix, indent)
 	if err != nil {
 		log.Println("failed to marshal transform: ", err)
 	}
@@ -140,15 +474,36 @@ func (tr *Transform) ReturnOutput() string {
 	return string(data)
 }
 
+// ReturnRequestOutput returns the XML representation of the request message.
+func (tr *Transform) ReturnRequestOutput() string {
+
+	out, err := marshal(&Transform{RequestMessage: tr.RequestMessage})
+	if err != nil {
+		log.Println("failed to marshal transform: ", err)
+	}
+
+	return out
+}
+
 // ThrowExceptions generates an exception message.
+// The response and request messages are removed, so that only the exceptions are sent to maltego.
+// Errors are logged, in that case an empty string is returned, use ThrowExceptionsE to handle them.
 func (tr *Transform) ThrowExceptions() string {
 
-	tr.ResponseMessage = nil
-
-	data, err := xml.Marshal(tr)
+	out, err := tr.ThrowExceptionsE()
 	if err != nil {
 		log.Println("failed to marshal transform: ", err)
 	}
 
-	return string(data)
+	return out
+}
+
+// ThrowExceptionsE generates an exception message, or returns an error if it could not be marshaled.
+// The response and request messages are removed, so that only the exceptions are sent to maltego.
+func (tr *Transform) ThrowExceptionsE() (string, error) {
+
+	tr.ResponseMessage = nil
+	tr.RequestMessage = nil
+
+	return marshal(tr)
 }
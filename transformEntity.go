@@ -14,11 +14,18 @@
 package maltego
 
 import (
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 )
 
+// ErrInvalidIconURL indicates an icon URL that can not be displayed by maltego.
+var ErrInvalidIconURL = errors.New("invalid icon url")
+
 /*
  *	Entity
  */
@@ -35,6 +42,46 @@ type Entity struct {
 	Fields    *AdditionalFields   `xml:"AdditionalFields,omitempty"`
 }
 
+// UnmarshalXML decodes an entity, accepting any casing for the name of the type attribute
+// and lowercase value and weight elements, e.g. type="..." and <value>, as sent by some servers.
+func (tre *Entity) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+
+	// Alias has the same fields, but not the UnmarshalXML method.
+	// It must be exported, encoding/xml can not set the XMLName of an unexported embedded struct.
+	type Alias Entity
+
+	var raw struct {
+		Alias
+		LowerValue  *string `xml:"value"`
+		LowerWeight *string `xml:"weight"`
+	}
+
+	attrs := make([]xml.Attr, len(start.Attr))
+	for i, a := range start.Attr {
+		if a.Name.Space == "" && strings.EqualFold(a.Name.Local, "type") {
+			a.Name.Local = "Type"
+		}
+		attrs[i] = a
+	}
+	start.Attr = attrs
+
+	err := d.DecodeElement(&raw, &start)
+	if err != nil {
+		return err
+	}
+
+	*tre = Entity(raw.Alias)
+
+	if raw.LowerValue != nil && tre.Value == "" {
+		tre.Value = *raw.LowerValue
+	}
+	if raw.LowerWeight != nil && tre.Weight == "" {
+		tre.Weight = *raw.LowerWeight
+	}
+
+	return nil
+}
+
 // AdditionalFields is a container for fields.
 type AdditionalFields struct {
 	XMLName xml.Name `xml:"AdditionalFields"`
@@ -69,13 +116,33 @@ func NewEntity(typ, value string, weight string) *Entity {
 	}
 }
 
+// GetFieldByName returns the value of the field with the given name, or an empty string if there is none.
 func (tre *Entity) GetFieldByName(name string) string {
+	if f := tre.getField(name); f != nil {
+		return f.Text
+	}
+	return ""
+}
+
+// GetFieldMatchingRule returns the matching rule of the field with the given name, or an empty string if there is none.
+func (tre *Entity) GetFieldMatchingRule(name string) string {
+	if f := tre.getField(name); f != nil {
+		return f.MatchingRule
+	}
+	return ""
+}
+
+// getField returns the first field with the given name, or nil if there is none.
+func (tre *Entity) getField(name string) *Field {
+	if tre.Fields == nil {
+		return nil
+	}
 	for _, f := range tre.Fields.Items {
 		if f.Name == name {
-			return f.Text
+			return f
 		}
 	}
-	return ""
+	return nil
 }
 
 // AddProperty adds a property.
@@ -94,6 +161,18 @@ func (tre *Entity) AddProperty(fieldName, displayName, matchingRule, value strin
 	})
 }
 
+// SetProperty sets a property, replacing an existing field with the same name instead of adding a duplicate.
+func (tre *Entity) SetProperty(fieldName, displayName, matchingRule, value string) {
+	if f := tre.getField(fieldName); f != nil {
+		f.Text = EscapeText(value)
+		f.DisplayName = displayName
+		f.MatchingRule = matchingRule
+		return
+	}
+
+	tre.AddProperty(fieldName, displayName, matchingRule, value)
+}
+
 // AddProp is shorthand for a strict AddProperty, that uses the title version of the fieldName as displayName.
 func (tre *Entity) AddProp(fieldName, value string) {
 
@@ -106,16 +185,57 @@ func (tre *Entity) AddProp(fieldName, value string) {
 		Text:         EscapeText(value),
 		MatchingRule: Strict,
 		Name:         fieldName,
-		DisplayName:  strings.Title(fieldName),
+		DisplayName:  titleCase(fieldName),
 	})
 }
 
-// AddDisplayInformation adds display information.
-func (tre *Entity) AddDisplayInformation(text, name string) {
+// AddDisplayInformation adds display information with the HTML content and the section title.
+// Note the order of the arguments: the content comes first, prefer AddDisplaySection for new code.
+func (tre *Entity) AddDisplayInformation(content, title string) {
+	tre.addDisplayLabel(NewDisplayLabel(content, title))
+}
+
+// AddDisplaySection adds a section with the given title and HTML content to the detail view of the entity.
+func (tre *Entity) AddDisplaySection(title, html string) {
+	tre.addDisplayLabel(NewHTMLDisplayLabel(title, html))
+}
+
+// addDisplayLabel adds the label to the display information.
+func (tre *Entity) addDisplayLabel(l *DisplayLabel) {
 	if tre.Info == nil {
 		tre.Info = &DisplayInformation{}
 	}
-	tre.Info.Labels = append(tre.Info.Labels, NewDisplayLabel(text, name))
+	tre.Info.Labels = append(tre.Info.Labels, l)
+}
+
+// SetIconURL sets the URL of the icon for the entity.
+// Only absolute http and https URLs or data URIs are accepted, because maltego can not resolve relative paths.
+func (tre *Entity) SetIconURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidIconURL, err)
+	}
+
+	switch parsed.Scheme {
+	case "http", "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("%w: missing host in %q", ErrInvalidIconURL, u)
+		}
+	case "data":
+		if parsed.Opaque == "" {
+			return fmt.Errorf("%w: empty data uri", ErrInvalidIconURL)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported scheme in %q", ErrInvalidIconURL, u)
+	}
+
+	tre.IconURL = u
+	return nil
+}
+
+// SetIconDataURI embeds the image data with the given mime type, e.g. "image/png", as the icon for the entity.
+func (tre *Entity) SetIconDataURI(mime string, data []byte) {
+	tre.IconURL = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
 }
 
 // SetLinkColor sets the link color.
@@ -139,17 +259,90 @@ func (tre *Entity) SetLinkLabel(label string) {
 	tre.AddProperty(Label, "Label", Loose, label)
 }
 
+// SetLinkLabelVisibility controls whether the label of the incoming link is shown,
+// via the link#maltego.link.show-label property.
+func (tre *Entity) SetLinkLabelVisibility(v LinkLabelVisibility) {
+	tre.SetProperty(LinkShowLabel, "Show Label", Loose, string(v))
+}
+
 // SetBookmark sets a bookmark on the entity.
 func (tre *Entity) SetBookmark(bookmark string) {
 	tre.AddProperty(Bookmark, "Bookmark", Loose, bookmark)
 }
 
+// SetBookmarkColor sets a bookmark with the given color on the entity.
+// Invalid colors are ignored, because maltego would not display them.
+func (tre *Entity) SetBookmarkColor(color BookmarkColor) {
+	if !color.Valid() {
+		fmt.Println("invalid bookmark color:", color)
+		return
+	}
+
+	tre.SetBookmark(string(color))
+}
+
 // SetNote sets a note on the entity.
 func (tre *Entity) SetNote(note string) {
 	tre.AddProperty(Notes, "Notes", Loose, note)
 }
 
+// AppendNote appends a note to the existing notes of the entity, separated by a newline.
+func (tre *Entity) AppendNote(note string) {
+	if f := tre.getField(Notes); f != nil {
+		f.Text += "\n" + EscapeText(note)
+		return
+	}
+
+	tre.SetNote(note)
+}
+
 // SetLinkDirection sets the link direction
 func (tre *Entity) SetLinkDirection(dir LinkDirection) {
 	tre.AddProperty(PropertyLinkDirection, "Direction", Loose, string(dir))
 }
+
+// LinkBuilder groups the styling of the link to an entity.
+type LinkBuilder struct {
+	entity *Entity
+}
+
+// Link returns a builder to style the link to the entity.
+func (tre *Entity) Link() *LinkBuilder {
+	return &LinkBuilder{entity: tre}
+}
+
+// Color sets the link color.
+func (l *LinkBuilder) Color(color string) *LinkBuilder {
+	l.entity.SetLinkColor(color)
+	return l
+}
+
+// Style sets the link style, see the LinkStyle constants.
+func (l *LinkBuilder) Style(style string) *LinkBuilder {
+	l.entity.SetLinkStyle(style)
+	return l
+}
+
+// Thickness sets the link thickness.
+func (l *LinkBuilder) Thickness(thick int) *LinkBuilder {
+	l.entity.SetLinkThickness(thick)
+	return l
+}
+
+// Label sets the link label.
+func (l *LinkBuilder) Label(label string) *LinkBuilder {
+	l.entity.SetLinkLabel(label)
+	return l
+}
+
+// ShowLabel sets the visibility of the link label.
+func (l *LinkBuilder) ShowLabel(v LinkLabelVisibility) *LinkBuilder {
+	l.entity.SetLinkLabelVisibility(v)
+	return l
+}
+
+// Direction sets the link direction.
+func (l *LinkBuilder) Direction(dir LinkDirection) *LinkBuilder {
+	l.entity.SetLinkDirection(dir)
+	return l
+}
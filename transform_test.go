@@ -15,17 +15,14 @@ package maltego
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 )
 
-func TestParseMaltegoToTDS(t *testing.T) {
-
-	var (
-		tr = &Transform{}
-		// Sample request XML going from Maltego client to TDS when running the example "DNSToIP" Transform.
-		maltegoToTDS = `<MaltegoMessage>
+// Sample request XML going from Maltego client to TDS when running the example "DNSToIP" Transform.
+const maltegoToTDS = `<MaltegoMessage>
 		<MaltegoTransformRequestMessage>
 			<Entities>
 				<Entity Type="DNSName">
@@ -42,7 +39,10 @@ func TestParseMaltegoToTDS(t *testing.T) {
 			<Limits SoftLimit="256" HardLimit="256"/>
 		</MaltegoTransformRequestMessage>
 	</MaltegoMessage>`
-	)
+
+func TestParseMaltegoToTDS(t *testing.T) {
+
+	tr := &Transform{}
 
 	err := xml.Unmarshal([]byte(maltegoToTDS), tr)
 	if err != nil {
@@ -98,12 +98,8 @@ func TestParseMaltegoToTDS(t *testing.T) {
 	}
 }
 
-func TestParseTDSToMaltego(t *testing.T) {
-
-	var (
-		tr = &Transform{}
-		// Sample response XML of the above request going from TDS to Maltego client when running the example "DNSToIP" Transform.
-		tdsToMaltego = `<MaltegoMessage>
+// Sample response XML of the above request going from TDS to Maltego client when running the example "DNSToIP" Transform.
+const tdsToMaltego = `<MaltegoMessage>
 		<MaltegoTransformResponseMessage>
 			<Entities>
 				<Entity Type="maltego.IPv4Address">
@@ -116,7 +112,10 @@ func TestParseTDSToMaltego(t *testing.T) {
 			</UIMessages>
 		</MaltegoTransformResponseMessage>
 	</MaltegoMessage>`
-	)
+
+func TestParseTDSToMaltego(t *testing.T) {
+
+	tr := &Transform{}
 
 	err := xml.Unmarshal([]byte(tdsToMaltego), tr)
 	if err != nil {
@@ -304,3 +303,599 @@ func TestLabel(t *testing.T) {
 func TestEscape(t *testing.T) {
 	fmt.Println(EscapeText("\n"))
 }
+
+func TestHTMLDisplayLabel(t *testing.T) {
+	l := NewHTMLDisplayLabel("Whois", "<b>registered</b>")
+
+	data, err := xml.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the title is the Name attribute, the content is the CDATA body
+	compare(t, data, `<Label Name="Whois" Type="text/html"><![CDATA[<b>registered</b>]]></Label>`)
+
+	// NewDisplayLabel takes the content first
+	data, err = xml.Marshal(NewDisplayLabel("<b>registered</b>", "Whois"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, data, `<Label Name="Whois" Type="text/html"><![CDATA[<b>registered</b>]]></Label>`)
+}
+
+func TestEntityDisplaySection(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+	e.AddDisplaySection("Whois", "<b>registered</b>")
+
+	data, err := xml.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the title is shown as the section name and the body in the panel
+	exp := `<Entity Type="maltego.Domain"><Value>example.com</Value><Weight>100</Weight><DisplayInformation><Label Name="Whois" Type="text/html"><![CDATA[<b>registered</b>]]></Label></DisplayInformation></Entity>`
+	compare(t, data, exp)
+}
+
+func TestEntityLinkBuilder(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+	e.Link().
+		Color("#ff0000").
+		Style(LinkStyleDashed).
+		Thickness(3).
+		Label("resolves to").
+		Direction(OutputToInput)
+
+	for name, expected := range map[string]string{
+		LinkColor:             "#ff0000",
+		LinkStyle:             LinkStyleDashed,
+		LinkThickness:         "3",
+		Label:                 "resolves to",
+		PropertyLinkDirection: string(OutputToInput),
+	} {
+		if v := e.GetFieldByName(name); v != expected {
+			t.Fatal("unexpected value for", name, ":", v)
+		}
+	}
+}
+
+func TestEntityBookmarkColor(t *testing.T) {
+	typed := NewEntity("maltego.Domain", "example.com", "100")
+	typed.SetBookmarkColor(BookmarkColorGreen)
+
+	raw := NewEntity("maltego.Domain", "example.com", "100")
+	raw.SetBookmark(BookMarkColorGreen)
+
+	if typed.GetFieldByName(Bookmark) != raw.GetFieldByName(Bookmark) || typed.GetFieldByName(Bookmark) != "1" {
+		t.Fatal("unexpected bookmark value", typed.GetFieldByName(Bookmark))
+	}
+
+	invalid := NewEntity("maltego.Domain", "example.com", "100")
+	invalid.SetBookmarkColor("purple")
+	if invalid.Fields != nil {
+		t.Fatal("invalid bookmark color should be ignored")
+	}
+}
+
+func TestEntityAppendNote(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+	e.AppendNote("resolved via DNS")
+	e.AppendNote("seen in <passive> DNS")
+
+	if v := e.GetFieldByName(Notes); v != "resolved via DNS\nseen in &lt;passive> DNS" {
+		t.Fatal("unexpected notes", v)
+	}
+
+	if len(e.Fields.Items) != 1 {
+		t.Fatal("expected a single notes field, got", len(e.Fields.Items))
+	}
+}
+
+func TestTransformDeduplicate(t *testing.T) {
+	trx := Transform{}
+	trx.SetDeduplicate(true)
+
+	first := trx.AddEntity("maltego.Domain", "example.com")
+	trx.AddEntity("maltego.Domain", "example.org")
+	second := trx.AddEntity("maltego.Domain", "example.com")
+
+	if first != second {
+		t.Fatal("expected the existing entity to be returned")
+	}
+
+	out := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities><Entity Type="maltego.Domain"><Value>example.com</Value><Weight>100</Weight></Entity><Entity Type="maltego.Domain"><Value>example.org</Value><Weight>100</Weight></Entity></Entities><UIMessages></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>`
+	compare(t, []byte(trx.ReturnOutput()), out)
+}
+
+func TestTransformSortByWeight(t *testing.T) {
+	trx := Transform{}
+
+	for _, e := range []struct{ value, weight string }{
+		{"a", "10"},
+		{"b", ""},
+		{"c", "100"},
+		{"d", "invalid"},
+		{"e", "10"},
+		{"f", "50.5"},
+	} {
+		trx.AddEntity("maltego.Phrase", e.value).Weight = e.weight
+	}
+
+	trx.SortByWeight()
+
+	var order string
+	for _, e := range trx.ResponseMessage.Entities.Items {
+		order += e.Value
+	}
+
+	if order != "cfaebd" {
+		t.Fatal("unexpected order", order)
+	}
+}
+
+func TestTransformTruncate(t *testing.T) {
+	newTransform := func() *Transform {
+		trx := &Transform{}
+		for _, v := range []string{"a", "b", "c"} {
+			trx.AddEntity("maltego.Phrase", v)
+		}
+		return trx
+	}
+
+	for _, tc := range []struct {
+		n        int
+		entities int
+		message  string
+	}{
+		{5, 3, ""},
+		{3, 3, ""},
+		{2, 2, "dropped 1 of 3 entities"},
+		{0, 0, "dropped 3 of 3 entities"},
+		{-1, 0, "dropped 3 of 3 entities"},
+	} {
+		trx := newTransform()
+		trx.Truncate(tc.n)
+
+		if len(trx.ResponseMessage.Entities.Items) != tc.entities {
+			t.Fatal("unexpected number of entities for n =", tc.n, ":", len(trx.ResponseMessage.Entities.Items))
+		}
+
+		msgs := trx.ResponseMessage.UIMessages.Items
+		if tc.message == "" {
+			if len(msgs) != 0 {
+				t.Fatal("unexpected message for n =", tc.n, msgs[0].Text)
+			}
+			continue
+		}
+
+		if len(msgs) != 1 || msgs[0].Text != tc.message || msgs[0].MessageType != UIMessageInform {
+			t.Fatal("unexpected messages for n =", tc.n, msgs)
+		}
+	}
+}
+
+func TestEntitySetProperty(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+	e.SetProperty("status", "Status", Strict, "unknown")
+	e.SetProperty("status", "Status", Loose, "registered")
+
+	if len(e.Fields.Items) != 1 {
+		t.Fatal("expected a single field, got", len(e.Fields.Items))
+	}
+
+	if f := e.Fields.Items[0]; f.Text != "registered" || f.MatchingRule != Loose {
+		t.Fatal("unexpected field", f.Text, f.MatchingRule)
+	}
+}
+
+func TestTransformCopyRequestFieldsTo(t *testing.T) {
+	trx := &Transform{}
+
+	err := xml.Unmarshal([]byte(`<MaltegoMessage>
+		<MaltegoTransformRequestMessage>
+			<Entities>
+				<Entity Type="maltego.Domain">
+					<AdditionalFields>
+						<Field Name="fqdn" DisplayName="Domain Name" MatchingRule="strict">example.com</Field>
+						<Field Name="whois-info" DisplayName="WHOIS Info" MatchingRule="loose">registered</Field>
+						<Field Name="source" DisplayName="Source">crawler</Field>
+					</AdditionalFields>
+					<Value>example.com</Value>
+					<Weight>0</Weight>
+				</Entity>
+			</Entities>
+		</MaltegoTransformRequestMessage>
+	</MaltegoMessage>`), trx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := trx.AddEntity("maltego.IPv4Address", "93.184.216.34")
+	trx.CopyRequestFieldsTo(e, "fqdn", "source")
+
+	if len(e.Fields.Items) != 2 || e.GetFieldByName("fqdn") != "example.com" || e.GetFieldByName("source") != "crawler" {
+		t.Fatal("unexpected fields", e.Fields.Items)
+	}
+
+	all := trx.AddEntity("maltego.IPv4Address", "93.184.216.35")
+	trx.CopyRequestFieldsTo(all)
+
+	if len(all.Fields.Items) != 3 || all.GetFieldByName("whois-info") != "registered" {
+		t.Fatal("unexpected fields", all.Fields.Items)
+	}
+
+	// no fields on the request entity
+	trx.RequestMessage.Entities.Items[0].Fields = nil
+	none := trx.AddEntity("maltego.IPv4Address", "93.184.216.36")
+	trx.CopyRequestFieldsTo(none)
+
+	if none.Fields != nil {
+		t.Fatal("unexpected fields", none.Fields.Items)
+	}
+}
+
+func TestEntityGetFieldMatchingRule(t *testing.T) {
+	trx := &Transform{}
+
+	err := xml.Unmarshal([]byte(`<MaltegoMessage>
+		<MaltegoTransformRequestMessage>
+			<Entities>
+				<Entity Type="maltego.Phrase">
+					<AdditionalFields>
+						<Field Name="text" DisplayName="Text" MatchingRule="loose">hello</Field>
+						<Field Name="lang" DisplayName="Language">en</Field>
+					</AdditionalFields>
+					<Value>hello</Value>
+					<Weight>0</Weight>
+				</Entity>
+			</Entities>
+		</MaltegoTransformRequestMessage>
+	</MaltegoMessage>`), trx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := trx.RequestMessage.Entities.Items[0]
+	if rule := e.GetFieldMatchingRule("text"); rule != Loose {
+		t.Fatal("unexpected matching rule", rule)
+	}
+	if rule := e.GetFieldMatchingRule("lang"); rule != "" {
+		t.Fatal("unexpected matching rule", rule)
+	}
+	if rule := e.GetFieldMatchingRule("missing"); rule != "" {
+		t.Fatal("unexpected matching rule", rule)
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	req := NewRequest()
+
+	e := req.RequestMessage.AddEntity("DNSName", "alpine.paterva.com")
+	e.Genealogy = &Genealogy{
+		Type: GenealogyType{
+			Name:    "maltego.DNSName",
+			OldName: "DNSName",
+		},
+	}
+	e.AddProperty("fqdn", "DNS Name", "", "alpine.paterva.com")
+	req.RequestMessage.SetLimits(256, 256)
+
+	// the sample is normalized by parsing and serializing it again
+	sample := &Transform{}
+	if err := xml.Unmarshal([]byte(maltegoToTDS), sample); err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, []byte(req.ReturnRequestOutput()), sample.ReturnRequestOutput())
+}
+
+func TestTransformAddTransformField(t *testing.T) {
+	trx := &Transform{}
+
+	trx.AddTransformField("api.key", "secret")
+	trx.AddTransformField("max.results", "10 & more")
+
+	out := trx.ReturnRequestOutput()
+	if !strings.Contains(out, `<TransformFields><Field Name="api.key">secret</Field><Field Name="max.results">10 &amp; more</Field></TransformFields>`) {
+		t.Fatal("unexpected transform fields", out)
+	}
+
+	parsed := &Transform{}
+	if err := xml.Unmarshal([]byte(out), parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := parsed.RequestMessage.TransformFields.Fields
+	if len(fields) != 2 || fields[0].Name != "api.key" || fields[0].Text != "secret" || fields[1].Name != "max.results" || fields[1].Text != "10 & more" {
+		t.Fatal("unexpected transform fields", fields)
+	}
+}
+
+func TestEntitySetIconURL(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+
+	if err := e.SetIconURL("https://example.com/icon.png"); err != nil {
+		t.Fatal(err)
+	}
+	if e.IconURL != "https://example.com/icon.png" {
+		t.Fatal("unexpected icon url", e.IconURL)
+	}
+
+	for _, u := range []string{"icons/icon.png", "ftp://example.com/icon.png", "https:///icon.png", "data:"} {
+		if err := e.SetIconURL(u); !errors.Is(err, ErrInvalidIconURL) {
+			t.Fatal("expected ErrInvalidIconURL for", u, "got", err)
+		}
+	}
+
+	// invalid URLs leave the previous icon in place
+	if e.IconURL != "https://example.com/icon.png" {
+		t.Fatal("unexpected icon url", e.IconURL)
+	}
+}
+
+func TestEntitySetIconDataURI(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+
+	e.SetIconDataURI("image/png", []byte("png"))
+	if e.IconURL != "data:image/png;base64,cG5n" {
+		t.Fatal("unexpected icon url", e.IconURL)
+	}
+	if err := e.SetIconURL(e.IconURL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEntitySetLinkLabelVisibility(t *testing.T) {
+	e := NewEntity("maltego.Domain", "example.com", "100")
+
+	e.Link().Label("resolves to").ShowLabel(LinkLabelHide)
+	e.SetLinkLabelVisibility(LinkLabelShow)
+
+	data, err := xml.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `<Entity Type="maltego.Domain"><Value>example.com</Value><Weight>100</Weight><AdditionalFields><Field MatchingRule="loose" Name="link#maltego.link.label" DisplayName="Label">resolves to</Field><Field MatchingRule="loose" Name="link#maltego.link.show-label" DisplayName="Show Label">1</Field></AdditionalFields></Entity>`
+
+	compare(t, data, exp)
+}
+
+func TestTransformAddUIMessageTyped(t *testing.T) {
+	var (
+		typed   = &Transform{}
+		untyped = &Transform{}
+	)
+
+	for _, typ := range []UIMessageType{UIMessageTypeFatal, UIMessageTypePartialError, UIMessageTypeInform, UIMessageTypeDebug} {
+		typed.AddUIMessageTyped("message", typ)
+		untyped.AddUIMessage("message", string(typ))
+	}
+
+	compare(t, []byte(typed.ReturnOutput()), untyped.ReturnOutput())
+
+	typed.AddUIMessageTyped("message", UIMessageType("Warning"))
+	if n := len(typed.ResponseMessage.UIMessages.Items); n != 4 {
+		t.Fatal("invalid message type has been added, got", n, "messages")
+	}
+}
+
+func TestTransformDeduplicateUIMessages(t *testing.T) {
+	trx := &Transform{}
+	trx.SetDeduplicateUIMessages(true)
+
+	for i := 0; i < 3; i++ {
+		trx.AddUIMessage("timeout", UIMessagePartialError)
+	}
+	trx.AddUIMessage("timeout", UIMessageDebug)
+	trx.AddUIMessage("done", UIMessageInform)
+
+	out := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities></Entities><UIMessages><UIMessage MessageType="PartialError">timeout (x3)</UIMessage><UIMessage MessageType="Debug">timeout</UIMessage><UIMessage MessageType="Inform">done</UIMessage></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>`
+	compare(t, []byte(trx.ReturnOutput()), out)
+}
+
+func TestTransformThrowExceptionsWithRequest(t *testing.T) {
+	trx := &Transform{}
+	if err := xml.Unmarshal([]byte(maltegoToTDS), trx); err != nil {
+		t.Fatal(err)
+	}
+
+	trx.AddEntity("maltego.IPv4Address", "93.184.216.34")
+	trx.AddException("oops", "errorCode")
+
+	out := `<MaltegoMessage><MaltegoTransformExceptionMessage><Exceptions><Exception code="errorCode">oops</Exception></Exceptions></MaltegoTransformExceptionMessage></MaltegoMessage>`
+	compare(t, []byte(trx.ThrowExceptions()), out)
+}
+
+// failMarshal makes marshaling transforms with a response message fail until the test is finished.
+func failMarshal(t *testing.T) {
+	t.Cleanup(func() {
+		marshal = encodeTransform
+	})
+	marshal = func(tr *Transform) (string, error) {
+		if tr.ResponseMessage != nil {
+			return "", errors.New("marshal failed")
+		}
+		return encodeTransform(tr)
+	}
+}
+
+func TestTransformReturnOutputE(t *testing.T) {
+	trx := &Transform{}
+	trx.AddEntity("maltego.IPv4Address", "93.184.216.34")
+
+	out, err := trx.ReturnOutputE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, []byte(out), trx.ReturnOutput())
+
+	failMarshal(t)
+
+	out, err = trx.ReturnOutputE()
+	if err == nil || out != "" {
+		t.Fatal("expected error, got", out)
+	}
+	if trx.ReturnOutput() != "" {
+		t.Fatal("expected empty output")
+	}
+}
+
+func TestTransformReturnOutputIndent(t *testing.T) {
+	trx := &Transform{}
+	e := trx.AddEntity("maltego.Domain", "example.com")
+	e.AddProp("registrar", "Example Inc.")
+	e.AddDisplaySection("Whois", "<b>registered</b>")
+	trx.AddUIMessage("done", UIMessageInform)
+
+	out := trx.ReturnOutputIndent("", "  ")
+	if !strings.Contains(out, "\n  <MaltegoTransformResponseMessage>\n") {
+		t.Fatal("output is not indented", out)
+	}
+
+	parsed := &Transform{}
+	if err := xml.Unmarshal([]byte(out), parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, []byte(parsed.ReturnOutput()), trx.ReturnOutput())
+}
+
+func TestTransformReturnOutputWithHeader(t *testing.T) {
+	trx := &Transform{}
+	trx.AddEntity("maltego.Domain", "example.com")
+
+	out := trx.ReturnOutputWithHeader()
+
+	header := `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	if !strings.HasPrefix(out, header) {
+		t.Fatal("missing XML declaration", out)
+	}
+
+	compare(t, []byte(strings.TrimPrefix(out, header)), trx.ReturnOutput())
+}
+
+func TestParseEntityCasing(t *testing.T) {
+	for _, req := range []string{
+		`<Entity Type="maltego.Domain"><Value>example.com</Value><Weight>42</Weight></Entity>`,
+		`<Entity type="maltego.Domain"><value>example.com</value><weight>42</weight></Entity>`,
+		`<Entity TYPE="maltego.Domain"><Value>example.com</Value><weight>42</weight></Entity>`,
+	} {
+		trx := &Transform{}
+		err := xml.Unmarshal([]byte(`<MaltegoMessage><MaltegoTransformRequestMessage><Entities>`+req+`</Entities></MaltegoTransformRequestMessage></MaltegoMessage>`), trx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := trx.RequestMessage.Entities.Items[0]
+		if e.Type != "maltego.Domain" || e.Value != "example.com" || e.Weight != "42" {
+			t.Fatalf("unexpected entity for %s: %+v", req, e)
+		}
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	data := `<MaltegoMessage>
+		<MaltegoTransformResponseMessage>
+			<Entities>
+				<Entity Type="maltego.IPv4Address">
+					<Value>173.230.156.137</Value>
+					<Weight>100</Weight>
+					<DisplayInformation>
+						<Label Name="Whois" Type="text/html"><![CDATA[<b>Linode</b>]]></Label>
+					</DisplayInformation>
+					<IconURL>https://example.com/ip.png</IconURL>
+					<AdditionalFields>
+						<Field Name="ipv4-address" DisplayName="IP Address" MatchingRule="strict">173.230.156.137</Field>
+						<Field Name="link#maltego.link.label" DisplayName="Label" MatchingRule="loose">resolves to</Field>
+					</AdditionalFields>
+				</Entity>
+			</Entities>
+			<UIMessages>
+				<UIMessage MessageType="Inform">complete</UIMessage>
+			</UIMessages>
+		</MaltegoTransformResponseMessage>
+	</MaltegoMessage>`
+
+	tr, err := ParseResponse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.ResponseMessage.Entities.Items) != 1 {
+		parseFailure(t, "len(tr.ResponseMessage.Entities.Items) != 1", data, tr)
+	}
+
+	e := tr.ResponseMessage.Entities.Items[0]
+	if e.Type != "maltego.IPv4Address" || e.Value != "173.230.156.137" || e.Weight != "100" || e.IconURL != "https://example.com/ip.png" {
+		parseFailure(t, "unexpected entity", data, tr)
+	}
+
+	if e.Fields == nil || len(e.Fields.Items) != 2 || e.GetFieldByName("ipv4-address") != "173.230.156.137" || e.GetFieldMatchingRule("link#maltego.link.label") != Loose {
+		parseFailure(t, "unexpected fields", data, tr)
+	}
+
+	if e.Info == nil || len(e.Info.Labels) != 1 || e.Info.Labels[0].Name != "Whois" || e.Info.Labels[0].Type != "text/html" || e.Info.Labels[0].Text != "<b>Linode</b>" {
+		parseFailure(t, "unexpected display information", data, tr)
+	}
+
+	// the parsed response serializes like a response built with the helpers
+	built := &Transform{}
+	b := built.AddEntity("maltego.IPv4Address", "173.230.156.137")
+	b.AddDisplaySection("Whois", "<b>Linode</b>")
+	if err = b.SetIconURL("https://example.com/ip.png"); err != nil {
+		t.Fatal(err)
+	}
+	b.AddProperty("ipv4-address", "IP Address", Strict, "173.230.156.137")
+	b.SetLinkLabel("resolves to")
+	built.AddUIMessage("complete", UIMessageInform)
+
+	compare(t, []byte(tr.ReturnOutput()), built.ReturnOutput())
+
+	if _, err = ParseResponse([]byte(maltegoToTDS)); !errors.Is(err, ErrNoResponse) {
+		t.Fatal("expected ErrNoResponse, got", err)
+	}
+}
+
+func TestTransformKind(t *testing.T) {
+	for data, expected := range map[string]MessageKind{
+		maltegoToTDS: MessageKindRequest,
+		tdsToMaltego: MessageKindResponse,
+		`<MaltegoMessage><MaltegoTransformExceptionMessage><Exceptions><Exception code="errorCode">oops</Exception></Exceptions></MaltegoTransformExceptionMessage></MaltegoMessage>`: MessageKindException,
+		`<MaltegoMessage></MaltegoMessage>`: MessageKindUnknown,
+	} {
+		tr := &Transform{}
+		if err := xml.Unmarshal([]byte(data), tr); err != nil {
+			t.Fatal(err)
+		}
+
+		if kind := tr.Kind(); kind != expected {
+			t.Fatal("expected", expected, "got", kind, "for", data)
+		}
+	}
+}
+
+func TestAddEntityWithFields(t *testing.T) {
+	trx := Transform{}
+	e := trx.AddEntityWithFields("maltego.Domain", "example.com", map[string]string{
+		"whois":     "Example Co",
+		"fqdn":      "www.example.com",
+		"registrar": "Example Inc.",
+	})
+
+	var names []string
+	for _, f := range e.Fields.Items {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "fqdn,registrar,whois" {
+		t.Fatal("unexpected field order", names)
+	}
+
+	exp := `<MaltegoMessage><MaltegoTransformResponseMessage><Entities><Entity Type="maltego.Domain"><Value>example.com</Value><Weight>100</Weight><AdditionalFields><Field MatchingRule="strict" Name="fqdn" DisplayName="Fqdn">www.example.com</Field><Field MatchingRule="strict" Name="registrar" DisplayName="Registrar">Example Inc.</Field><Field MatchingRule="strict" Name="whois" DisplayName="Whois">Example Co</Field></AdditionalFields></Entity></Entities><UIMessages></UIMessages></MaltegoTransformResponseMessage></MaltegoMessage>`
+	compare(t, []byte(trx.ReturnOutput()), exp)
+
+	// an entity without fields
+	if e = trx.AddEntityWithFields("maltego.Domain", "example.org", nil); e.Fields != nil {
+		t.Fatal("unexpected fields", e.Fields)
+	}
+}
@@ -16,21 +16,40 @@ package maltego
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 var postEscapeReplacer = strings.NewReplacer("&#xA;", "\n", "&gt;", ">")
 
 type messageType string
 
-const debug = true
+// debugging is set to 1 if requests and responses should be dumped to stdout.
+var debugging int32
+
+// SetDebug sets whether the handlers print the full request and response bodies to stdout.
+// Debugging is disabled by default, as the bodies might contain sensitive data.
+func SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debugging, v)
+}
+
+// debug reports whether debugging has been enabled with SetDebug.
+func debug() bool {
+	return atomic.LoadInt32(&debugging) == 1
+}
 
 const (
 	response messageType = "RESPONSE"
@@ -38,7 +57,7 @@ const (
 )
 
 func dump(data []byte, typ messageType) {
-	if debug {
+	if debug() {
 		fmt.Println("================== " + typ + " ====================")
 		fmt.Println(string(data))
 		fmt.Println("===============================================")
@@ -138,6 +157,41 @@ func GetThicknessInterval(val, min, max uint64) int {
 	}
 }
 
+// titleCase returns s with the first letter of each word mapped to title case.
+// Unlike the deprecated strings.Title, apostrophes do not start a new word,
+// so "o'brien" becomes "O'brien" and not "O'Brien".
+func titleCase(s string) string {
+	var (
+		b    strings.Builder
+		prev = ' '
+	)
+
+	b.Grow(len(s))
+
+	for _, c := range s {
+		if isWordBoundary(prev) {
+			b.WriteRune(unicode.ToTitle(c))
+		} else {
+			b.WriteRune(c)
+		}
+		prev = c
+	}
+
+	return b.String()
+}
+
+// isWordBoundary reports whether a word can start after c.
+func isWordBoundary(c rune) bool {
+	switch {
+	case c == '\'' || c == '’':
+		return false
+	case unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsMark(c) || c == '_':
+		return false
+	default:
+		return true
+	}
+}
+
 // noPluralsMap contains words for which to make an exception when pluralizing nouns.
 var NoPluralsMap = map[string]struct{}{
 	"Software": {},
@@ -171,26 +225,71 @@ func Pluralize(name string) string {
 	return name
 }
 
+// GenServerListing will generate the Local.tas server listing for the provided transforms.
 func GenServerListing(prefix, outDir string, trs []*TransformCoreInfo) {
+	if err := GenServerListingE(prefix, outDir, trs); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// GenServerListingE is the error returning variant of GenServerListing.
+func GenServerListingE(prefix, outDir string, trs []*TransformCoreInfo) error {
+	return GenServerListingWithConfig(DefaultServerConfig(), prefix, outDir, trs)
+}
+
+// ServerConfig describes the transform server in a server listing.
+type ServerConfig struct {
+	Name            string
+	Description     string
+	URL             string
+	ProtocolVersion string
+	AuthType        string
+	Enabled         bool
+
+	// Seeds are added to the listing, so maltego can discover the transforms of the server.
+	Seeds []Seed
+}
+
+// DefaultServerConfig returns the configuration for local transforms hosted on this machine.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Name:            "Local",
+		Description:     "Local transforms hosted on this machine",
+		URL:             "http://localhost",
+		ProtocolVersion: "0.0",
+		AuthType:        "none",
+		Enabled:         true,
+	}
+}
+
+// GenServerListingWithConfig will generate the server listing for the provided transforms,
+// describing the server from cfg. The listing is written to Servers/<cfg.Name>.tas in outDir.
+func GenServerListingWithConfig(cfg ServerConfig, prefix, outDir string, trs []*TransformCoreInfo) error {
+	if err := checkDuplicateTransforms(trs); err != nil {
+		return err
+	}
+
 	srv := Server{
-		Name:        "Local",
-		Enabled:     true,
-		Description: "Local transforms hosted on this machine",
-		URL:         "http://localhost",
+		Name:        cfg.Name,
+		Enabled:     cfg.Enabled,
+		Description: cfg.Description,
+		URL:         cfg.URL,
 		LastSync:    time.Now().Format("2006-01-02 15:04:05.000 MST"), // example: 2020-06-23 20:47:24.433 CEST"
 		Protocol: struct {
 			Text    string `xml:",chardata"`
 			Version string `xml:"version,attr"`
 		}{
-			Version: "0.0",
+			Version: cfg.ProtocolVersion,
 		},
 		Authentication: struct {
 			Text string `xml:",chardata"`
 			Type string `xml:"type,attr"`
 		}{
-			Type: "none",
+			Type: cfg.AuthType,
+		},
+		Seeds: Seeds{
+			Items: cfg.Seeds,
 		},
-		Seeds: "",
 	}
 
 	for _, t := range trs {
@@ -204,26 +303,42 @@ func GenServerListing(prefix, outDir string, trs []*TransformCoreInfo) {
 
 	data, err := xml.MarshalIndent(srv, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal server listing: %w", err)
 	}
 
-	f, err := os.Create(filepath.Join(outDir, "Servers", "Local.tas"))
-	if err != nil {
-		log.Fatal(err)
-	}
+	return writeFile(filepath.Join(outDir, "Servers", cfg.Name+".tas"), data)
+}
 
-	_, err = f.Write(data)
-	if err != nil {
-		log.Fatal(err)
+// ErrDuplicateTransform indicates that a transform has been provided more than once.
+var ErrDuplicateTransform = errors.New("duplicate transform")
+
+// checkDuplicateTransforms returns an error if several transforms have the same ID.
+func checkDuplicateTransforms(trs []*TransformCoreInfo) error {
+	seen := make(map[string]struct{}, len(trs))
+
+	for _, t := range trs {
+		if _, ok := seen[t.ID]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateTransform, t.ID)
+		}
+		seen[t.ID] = struct{}{}
 	}
 
-	err = f.Close()
-	if err != nil {
+	return nil
+}
+
+// GenTransformSet will generate a transform set with the given name containing the provided transforms.
+func GenTransformSet(name string, description string, prefix string, outDir string, trs []*TransformCoreInfo) {
+	if err := GenTransformSetE(name, description, prefix, outDir, trs); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func GenTransformSet(name string, description string, prefix string, outDir string, trs []*TransformCoreInfo) {
+// GenTransformSetE is the error returning variant of GenTransformSet.
+func GenTransformSetE(name string, description string, prefix string, outDir string, trs []*TransformCoreInfo) error {
+	if err := checkDuplicateTransforms(trs); err != nil {
+		return fmt.Errorf("transform set %s: %w", name, err)
+	}
+
 	tSet := TransformSet{
 		Name:        name,
 		Description: description,
@@ -240,93 +355,229 @@ func GenTransformSet(name string, description string, prefix string, outDir stri
 
 	data, err := xml.MarshalIndent(tSet, "", " ")
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to marshal transform set %s: %w", name, err)
 	}
 
-	_ = os.MkdirAll(filepath.Join(outDir, "TransformSets"), 0o700)
-	f, err := os.Create(filepath.Join(outDir, "TransformSets", name+".set"))
+	err = os.MkdirAll(filepath.Join(outDir, "TransformSets"), 0o700)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	_, err = f.Write(data)
-	if err != nil {
+	return writeFile(filepath.Join(outDir, "TransformSets", name+".set"), data)
+}
+
+// GenMaltegoArchive bootstraps the directory structure for a combined maltego configuration archive.
+func GenMaltegoArchive(ident, category string) {
+	if err := GenMaltegoArchiveE(ident, category); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	err = f.Close()
-	if err != nil {
-		log.Fatal(err)
+// GenMaltegoArchiveE is the error returning variant of GenMaltegoArchive.
+func GenMaltegoArchiveE(ident, category string) error {
+	return GenMaltegoArchiveWithOptions(ident, category, ArchiveOptions{})
+}
+
+// GenMaltegoArchiveWithOptions bootstraps the directory structure for a combined maltego configuration archive,
+// using the provided options.
+func GenMaltegoArchiveWithOptions(ident, category string, opts ArchiveOptions) error {
+	return genMaltegoArchive(ident, []entityCategory{{file: ident, name: category}}, opts)
+}
+
+// GenMaltegoArchiveCategories bootstraps the directory structure for a combined maltego configuration archive
+// like GenMaltegoArchiveWithOptions, for entities in several categories.
+// One category file is written for each of the categories, named after the category.
+func GenMaltegoArchiveCategories(ident string, categories []string, opts ArchiveOptions) error {
+	var (
+		files = make([]entityCategory, 0, len(categories))
+		seen  = make(map[string]string, len(categories))
+	)
+
+	for _, c := range categories {
+		file := categoryFileName(c)
+		if other, ok := seen[strings.ToLower(file)]; ok {
+			return fmt.Errorf("%w: categories %q and %q are both written to %s.category", ErrArchiveCollision, other, c, file)
+		}
+		seen[strings.ToLower(file)] = c
+
+		files = append(files, entityCategory{file: file, name: c})
 	}
+
+	return genMaltegoArchive(ident, files, opts)
 }
 
-func GenMaltegoArchive(ident, category string) {
+// entityCategory is written into the category file with the given name.
+type entityCategory struct {
+	file string
+	name string
+}
+
+// categoryFileRenamer replaces the characters that are not allowed in file names on some systems.
+var categoryFileRenamer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// categoryFileName returns the file name for the category file of name, without extension.
+func categoryFileName(name string) string {
+	return categoryFileRenamer.Replace(name)
+}
+
+// genMaltegoArchive bootstraps the directory structure for a combined maltego configuration archive
+// with the provided entity categories.
+func genMaltegoArchive(ident string, categories []entityCategory, opts ArchiveOptions) error {
 	// clean
 	_ = os.RemoveAll(ident)
 
 	// create directories
-	_ = os.MkdirAll(filepath.Join(ident, "Servers"), 0o700)
-	_ = os.MkdirAll(filepath.Join(ident, "TransformRepositories", "Local"), 0o700)
+	for _, dir := range []string{
+		filepath.Join(ident, "Servers"),
+		filepath.Join(ident, "TransformRepositories", "Local"),
+		filepath.Join(ident, "Entities"),
+		filepath.Join(ident, "EntityCategories"),
+		filepath.Join(ident, "Icons"),
+	} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
 
-	// create directories
-	_ = os.MkdirAll(filepath.Join(ident, "Entities"), 0o700)
-	_ = os.MkdirAll(filepath.Join(ident, "EntityCategories"), 0o700)
-	_ = os.MkdirAll(filepath.Join(ident, "Icons"), 0o700)
+	v, err := opts.version()
+	if err != nil {
+		return err
+	}
 
-	fVersion, err := os.Create(filepath.Join(ident, "version.properties"))
+	err = writeVersionProperties(ident, v)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer func() {
-		if errClose := fVersion.Close(); errClose != nil {
-			fmt.Println(errClose)
+	for _, c := range categories {
+		err = writeEntityCategory(filepath.Join(ident, "EntityCategories", c.file+".category"), c.name)
+		if err != nil {
+			return err
 		}
-	}()
+	}
 
-	fCategory, err := os.Create(filepath.Join(ident, "EntityCategories", ident+".category"))
-	if err != nil {
+	fmt.Println("bootstrapped configuration archive for Maltego")
+
+	return nil
+}
+
+// GenMachines will copy all machines from the machines directory into the archive for ident
+// and generate a properties file for each of them.
+func GenMachines(ident string, machinePrefix string) {
+	if err := GenMachinesE(ident, machinePrefix); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	defer func() {
-		if errClose := fCategory.Close(); errClose != nil {
-			fmt.Println(errClose)
-		}
-	}()
+// GenMachinesE is the error returning variant of GenMachines.
+func GenMachinesE(ident string, machinePrefix string) error {
+	return GenMachinesFrom("machines", ident, machinePrefix, nil)
+}
 
-	// Sat Jun 13 21:48:54 CEST 2020
-	_, _ = fVersion.WriteString(`#
-#` + time.Now().Format(time.UnixDate) + `
-maltego.client.version=4.2.12
-maltego.client.subtitle=
-maltego.pandora.version=1.4.2
-maltego.client.name=Maltego Classic Eval
-maltego.mtz.version=1.0
-maltego.graph.version=1.2`)
+// MachineProperties are written into the properties file of a machine.
+type MachineProperties struct {
 
-	_, _ = fCategory.WriteString("<EntityCategory name=\"" + category + "\"/>")
+	// Favorite shows the machine in the favorites of the maltego client.
+	Favorite bool
 
-	fmt.Println("bootstrapped configuration archive for Maltego")
+	// Enabled makes the machine available in the maltego client.
+	Enabled bool
+
+	// Extra contains additional properties, that are written sorted by key after the modelled ones.
+	Extra map[string]string
 }
 
-func GenMachines(ident string, machinePrefix string) {
+// Marshal returns the properties in the java .properties format used by maltego,
+// with ts as timestamp in the leading comment.
+func (p MachineProperties) Marshal(ts time.Time) []byte {
+	var b strings.Builder
+
+	b.WriteString("#" + ts.Format(time.UnixDate) + "\n")
+	b.WriteString("favorite=" + strconv.FormatBool(p.Favorite) + "\n")
+	b.WriteString("enabled=" + strconv.FormatBool(p.Enabled))
+
+	keys := make([]string, 0, len(p.Extra))
+	for k := range p.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.WriteString("\n" + propertiesEscaper.Replace(k) + "=" + propertiesEscaper.Replace(p.Extra[k]))
+	}
+
+	return []byte(b.String())
+}
+
+// propertiesEscaper escapes the characters with a special meaning in keys and values of .properties files.
+var propertiesEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+	"=", `\=`,
+	":", `\:`,
+	"#", `\#`,
+	"!", `\!`,
+)
+
+// DefaultMachineProperties are used if no properties have been provided for a machine.
+var DefaultMachineProperties = MachineProperties{
+	Favorite: true,
+	Enabled:  true,
+}
+
+// GenMachinesFrom will validate and copy all machines from srcDir into the archive for ident
+// and generate a properties file for each of them.
+// The properties for a machine are looked up by its file name via props,
+// if props is nil the DefaultMachineProperties are used.
+// Subdirectories of srcDir and files without the .machine extension are skipped.
+func GenMachinesFrom(srcDir, ident string, machinePrefix string, props func(name string) MachineProperties) error {
+	return GenMachinesFromWithOptions(srcDir, ident, machinePrefix, props, ArchiveOptions{})
+}
+
+// GenMachinesFromWithOptions is like GenMachinesFrom, but takes the timestamp of the properties files from opts.
+func GenMachinesFromWithOptions(srcDir, ident string, machinePrefix string, props func(name string) MachineProperties, opts ArchiveOptions) error {
+	ts, err := opts.timestamp()
+	if err != nil {
+		return err
+	}
+
 	path := filepath.Join(ident, "Machines")
 
-	err := os.Mkdir(path, 0700)
+	err = os.Mkdir(path, 0700)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	files, err := ioutil.ReadDir("machines")
+	// ReadDir returns the entries sorted by filename
+	files, err := os.ReadDir(srcDir)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".machine" {
+			continue
+		}
+
+		src, errRead := os.ReadFile(filepath.Join(srcDir, f.Name()))
+		if errRead != nil {
+			return errRead
+		}
+
+		err = ValidateMachine(string(src))
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name(), err)
+		}
+
+		p := DefaultMachineProperties
+		if props != nil {
+			p = props(f.Name())
+		}
 
 		// Machine Properties
-		propFile, errCompile := os.Create(
+		err = writeFile(
 			filepath.Join(
 				path,
 				machinePrefix+strings.Replace(
@@ -336,28 +587,25 @@ func GenMachines(ident string, machinePrefix string) {
 					1,
 				),
 			),
+			p.Marshal(ts),
 		)
-		if errCompile != nil {
-			log.Fatal(errCompile)
-		}
-
-		_, _ = propFile.WriteString(`#` + time.Now().Format(time.UnixDate) + `
-favorite=true
-enabled=true`)
-
-		err = propFile.Close()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Machine
 
-		CopyFile(
-			filepath.Join("machines", f.Name()),
+		err = writeFile(
 			filepath.Join(
 				path,
 				machinePrefix+filepath.Base(f.Name()),
 			),
+			src,
 		)
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
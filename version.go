@@ -0,0 +1,89 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VersionInfo describes the maltego versions written into the version.properties file of a configuration archive.
+type VersionInfo struct {
+	ClientName     string
+	ClientVersion  string
+	ClientSubtitle string
+	PandoraVersion string
+	MtzVersion     string
+	GraphVersion   string
+
+	// Timestamp is written into the comment heading the file, it is omitted if zero.
+	Timestamp time.Time
+}
+
+// DefaultVersionInfo returns the versions used for generated archives, with the current time as timestamp.
+func DefaultVersionInfo() VersionInfo {
+	return VersionInfo{
+		ClientName:     "Maltego",
+		ClientVersion:  "4.2.12",
+		ClientSubtitle: "",
+		PandoraVersion: "1.4.2",
+		MtzVersion:     "1.0",
+		GraphVersion:   "1.2",
+		Timestamp:      time.Now(),
+	}
+}
+
+// WriteVersionProperties writes the version.properties file for v to w.
+// All keys use the maltego. prefix expected by the maltego client.
+func WriteVersionProperties(w io.Writer, v VersionInfo) error {
+	var b strings.Builder
+
+	b.WriteString("#\n")
+	if !v.Timestamp.IsZero() {
+		b.WriteString("#" + v.Timestamp.Format(time.UnixDate) + "\n")
+	}
+
+	for _, p := range [][2]string{
+		{"maltego.client.version", v.ClientVersion},
+		{"maltego.client.subtitle", v.ClientSubtitle},
+		{"maltego.pandora.version", v.PandoraVersion},
+		{"maltego.client.name", v.ClientName},
+		{"maltego.mtz.version", v.MtzVersion},
+		{"maltego.graph.version", v.GraphVersion},
+	} {
+		b.WriteString(p[0] + "=" + propertiesEscaper.Replace(p[1]) + "\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeVersionProperties writes the version.properties file for v into dir.
+func writeVersionProperties(dir string, v VersionInfo) error {
+	f, err := os.Create(filepath.Join(dir, "version.properties"))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVersionProperties(f, v)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
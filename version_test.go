@@ -0,0 +1,178 @@
+/*
+ * MALTEGO - Go package that provides datastructures for interacting with the Maltego graphical link analysis tool.
+ * Copyright (c) 2021 Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package maltego
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteVersionProperties(t *testing.T) {
+	v := VersionInfo{
+		ClientName:     "Maltego",
+		ClientVersion:  "4.3.0",
+		ClientSubtitle: "",
+		PandoraVersion: "1.4.2",
+		MtzVersion:     "1.0",
+		GraphVersion:   "1.2",
+		Timestamp:      time.Date(2020, 6, 13, 21, 48, 54, 0, time.UTC),
+	}
+
+	var b strings.Builder
+	if err := WriteVersionProperties(&b, v); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `#
+#Sat Jun 13 21:48:54 UTC 2020
+maltego.client.version=4.3.0
+maltego.client.subtitle=
+maltego.pandora.version=1.4.2
+maltego.client.name=Maltego
+maltego.mtz.version=1.0
+maltego.graph.version=1.2
+`
+	if b.String() != expected {
+		t.Fatal("unexpected version properties", b.String())
+	}
+}
+
+func TestGenArchivesVersionProperties(t *testing.T) {
+	chdirTemp(t)
+
+	if err := GenEntityArchiveE("Test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenTransformArchiveE(); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenMaltegoArchiveE("test", "Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := WriteVersionProperties(&b, VersionInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// all archives use the same keys
+	keys := strings.SplitN(b.String(), "\n", 2)[1]
+	for _, k := range strings.Split(strings.TrimSpace(keys), "\n") {
+		k = strings.TrimSuffix(k, "=")
+
+		for _, archive := range []string{"entities", "transforms", "test"} {
+			data, errRead := os.ReadFile(filepath.Join(archive, "version.properties"))
+			if errRead != nil {
+				t.Fatal(errRead)
+			}
+			if !strings.Contains(string(data), "\n"+k+"=") {
+				t.Fatal("missing key", k, "in", archive, string(data))
+			}
+		}
+	}
+}
+
+func TestGenArchiveVersion(t *testing.T) {
+	chdirTemp(t)
+
+	opts := ArchiveOptions{
+		ModTime: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+		Version: VersionInfo{
+			ClientName:     "Maltego",
+			ClientVersion:  "4.5.0",
+			PandoraVersion: "1.4.2",
+			MtzVersion:     "1.1",
+			GraphVersion:   "1.3",
+		},
+	}
+
+	if err := GenMaltegoArchiveWithOptions("test", "Test", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenEntityArchiveWithOptions("Test", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenTransformArchiveWithOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `#
+#Wed Mar  1 12:00:00 UTC 2023
+maltego.client.version=4.5.0
+maltego.client.subtitle=
+maltego.pandora.version=1.4.2
+maltego.client.name=Maltego
+maltego.mtz.version=1.1
+maltego.graph.version=1.3
+`
+	for _, archive := range []string{"test", "entities", "transforms"} {
+		data, err := os.ReadFile(filepath.Join(archive, "version.properties"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatal("unexpected version properties for", archive, string(data))
+		}
+	}
+
+	// the defaults are used if no version has been provided
+	if err := GenTransformArchiveWithOptions(ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("transforms", "version.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\nmaltego.client.version="+DefaultVersionInfo().ClientVersion+"\n") {
+		t.Fatal("unexpected default version properties", string(data))
+	}
+}
+
+func TestGenArchivePartialVersion(t *testing.T) {
+	chdirTemp(t)
+
+	opts := ArchiveOptions{
+		ModTime: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+		Version: VersionInfo{
+			ClientVersion: "4.5.0",
+		},
+	}
+
+	if err := GenTransformArchiveWithOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("transforms", "version.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// empty fields are filled with the defaults
+	expected := `#
+#Wed Mar  1 12:00:00 UTC 2023
+maltego.client.version=4.5.0
+maltego.client.subtitle=
+maltego.pandora.version=1.4.2
+maltego.client.name=Maltego
+maltego.mtz.version=1.0
+maltego.graph.version=1.2
+`
+	if string(data) != expected {
+		t.Fatal("unexpected version properties", string(data))
+	}
+}